@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configFile holds the settings read from a timeout configuration file.
+// Values are kept as flag strings; arrays hold one entry per element.
+type configFile struct {
+	defaults map[string][]string
+	profiles map[string]map[string][]string
+}
+
+// unconfigurable lists the flags that cannot be set from a config file
+var unconfigurable = map[string]bool{
+	"help":         true,
+	"version":      true,
+	"profile":      true,
+	"print-config": true,
+}
+
+// envName returns the environment variable that overrides the named flag
+func envName(flagName string) string {
+	return "TIMEOUT_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnv sets the flags of fs that were not given on the command line
+// from their TIMEOUT_* environment variables. Empty variables are ignored.
+func applyEnv(fs *flag.FlagSet, lookup func(string) (string, bool)) error {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || explicit[f.Name] || (unconfigurable[f.Name] && f.Name != "profile") {
+			return
+		}
+		name := envName(f.Name)
+		value, ok := lookup(name)
+		if !ok || value == "" {
+			return
+		}
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid value for %s: %v", name, setErr)
+		}
+	})
+	return err
+}
+
+// configPath returns the configuration file to read: $TIMEOUT_CONFIG if set,
+// otherwise $XDG_CONFIG_HOME/timeout/config.toml (or ~/.config/...). The
+// second result reports whether the file must exist.
+func configPath() (string, bool) {
+	if path := os.Getenv("TIMEOUT_CONFIG"); path != "" {
+		return path, true
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", false
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "timeout", "config.toml"), false
+}
+
+// loadConfig reads the configuration file and applies its defaults and the
+// named profile to the flags of fs that were not set on the command line
+func loadConfig(fs *flag.FlagSet, profile string) error {
+	path, required := configPath()
+	if path == "" {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) && !required {
+			if profile != "" {
+				return fmt.Errorf("unknown profile '%s': no configuration file at %s", profile, path)
+			}
+			return nil
+		}
+		return fmt.Errorf("cannot read configuration: %v", err)
+	}
+	defer f.Close()
+
+	cf, err := parseConfigFile(f)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return applyConfig(fs, cf, profile)
+}
+
+// applyConfig sets the flags of fs from cf. Flags given on the command line
+// win over the profile, which wins over the file's top-level defaults.
+func applyConfig(fs *flag.FlagSet, cf *configFile, profile string) error {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	settings := []map[string][]string{cf.defaults}
+	if profile != "" {
+		p, ok := cf.profiles[profile]
+		if !ok {
+			return fmt.Errorf("unknown profile '%s'", profile)
+		}
+		settings = append(settings, p)
+	}
+
+	// Later settings replace earlier ones rather than adding to them
+	merged := make(map[string][]string)
+	for _, s := range settings {
+		for key, values := range s {
+			merged[key] = values
+		}
+	}
+
+	keys := make([]string, 0, len(merged))
+	for key := range merged {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := strings.ReplaceAll(key, "_", "-")
+		if fs.Lookup(name) == nil || unconfigurable[name] {
+			return fmt.Errorf("unknown setting '%s'", key)
+		}
+		if explicit[name] {
+			continue
+		}
+		for _, value := range merged[key] {
+			if err := fs.Set(name, value); err != nil {
+				return fmt.Errorf("invalid value for '%s': %v", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// writeEffectiveConfig prints the settings of fs in config file syntax
+func writeEffectiveConfig(w io.Writer, fs *flag.FlagSet) {
+	fs.VisitAll(func(f *flag.Flag) {
+		if unconfigurable[f.Name] {
+			return
+		}
+		key := strings.ReplaceAll(f.Name, "-", "_")
+		value := f.Value.String()
+
+		switch {
+		case isBoolFlag(f) && (value == "true" || value == "false"):
+			fmt.Fprintf(w, "%s = %s\n", key, value)
+		case isListFlag(f):
+			var items []string
+			for _, item := range *f.Value.(*stringList) {
+				items = append(items, strconv.Quote(item))
+			}
+			fmt.Fprintf(w, "%s = [%s]\n", key, strings.Join(items, ", "))
+		default:
+			fmt.Fprintf(w, "%s = %s\n", key, strconv.Quote(value))
+		}
+	})
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+func isListFlag(f *flag.Flag) bool {
+	_, ok := f.Value.(*stringList)
+	return ok
+}
+
+// parseConfigFile parses the subset of TOML used by timeout configuration
+// files: top-level key/value pairs, [profile.NAME] tables, strings, booleans,
+// numbers and single-line arrays of strings.
+func parseConfigFile(r io.Reader) (*configFile, error) {
+	cf := &configFile{
+		defaults: make(map[string][]string),
+		profiles: make(map[string]map[string][]string),
+	}
+	table := cf.defaults
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: invalid table header", lineNo)
+			}
+			header := strings.TrimSpace(line[1 : len(line)-1])
+			name, ok := strings.CutPrefix(header, "profile.")
+			if !ok {
+				return nil, fmt.Errorf("line %d: unknown table [%s]", lineNo, header)
+			}
+			if unquoted, err := strconv.Unquote(name); err == nil {
+				name = unquoted
+			}
+			if name == "" {
+				return nil, fmt.Errorf("line %d: empty profile name", lineNo)
+			}
+			if _, exists := cf.profiles[name]; exists {
+				return nil, fmt.Errorf("line %d: duplicate profile '%s'", lineNo, name)
+			}
+			table = make(map[string][]string)
+			cf.profiles[name] = table
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, fmt.Errorf("line %d: missing key", lineNo)
+		}
+		if _, exists := table[key]; exists {
+			return nil, fmt.Errorf("line %d: duplicate key '%s'", lineNo, key)
+		}
+
+		values, err := parseConfigValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		table[key] = values
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return cf, nil
+}
+
+// parseConfigValue parses a TOML scalar or array of strings
+func parseConfigValue(s string) ([]string, error) {
+	if strings.HasPrefix(s, "[") {
+		if !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("unterminated array")
+		}
+		values := []string{}
+		rest := strings.TrimSpace(s[1 : len(s)-1])
+		for rest != "" {
+			item, tail, err := cutString(rest)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, item)
+			tail = strings.TrimSpace(tail)
+			if tail != "" {
+				var ok bool
+				if tail, ok = strings.CutPrefix(tail, ","); !ok {
+					return nil, fmt.Errorf("expected ',' in array")
+				}
+			}
+			rest = strings.TrimSpace(tail)
+		}
+		return values, nil
+	}
+
+	if strings.HasPrefix(s, `"`) || strings.HasPrefix(s, "'") {
+		value, tail, err := cutString(s)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(tail) != "" {
+			return nil, fmt.Errorf("unexpected text after string")
+		}
+		return []string{value}, nil
+	}
+
+	switch s {
+	case "true", "false":
+		return []string{s}, nil
+	}
+	if _, err := strconv.ParseFloat(strings.ReplaceAll(s, "_", ""), 64); err == nil {
+		return []string{strings.ReplaceAll(s, "_", "")}, nil
+	}
+	return nil, fmt.Errorf("invalid value %s", s)
+}
+
+// cutString parses the quoted string at the start of s and returns its
+// value and the remaining text
+func cutString(s string) (string, string, error) {
+	switch {
+	case strings.HasPrefix(s, "'"):
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	case strings.HasPrefix(s, `"`):
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case '"':
+				value, err := strconv.Unquote(s[:i+1])
+				if err != nil {
+					return "", "", fmt.Errorf("invalid string %s", s[:i+1])
+				}
+				return value, s[i+1:], nil
+			}
+		}
+		return "", "", fmt.Errorf("unterminated string")
+	}
+	return "", "", fmt.Errorf("expected a string")
+}
+
+// stripComment removes a trailing # comment that is not inside a string
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestFlagSet returns a FlagSet with a representative subset of the
+// command-line flags
+func newTestFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("timeout", flag.ContinueOnError)
+	fs.String("kill-after", "", "")
+	fs.String("signal", "TERM", "")
+	fs.Bool("verbose", false, "")
+	fs.Bool("help", false, "")
+	fs.String("profile", "", "")
+	fs.Var(&stringList{}, "kill-on-output", "")
+	return fs
+}
+
+func TestParseConfigFile(t *testing.T) {
+	input := `
+# Defaults for every run
+kill_after = "10s"   # trailing comment
+verbose = true
+
+[profile.ci]
+signal = "INT"
+kill_after = 30
+kill_on_output = ["panic:", 'stderr:#fatal']
+
+[profile."slow runner"]
+signal = 'KILL'
+`
+	cf, err := parseConfigFile(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expectedDefaults := map[string][]string{
+		"kill_after": {"10s"},
+		"verbose":    {"true"},
+	}
+	if !reflect.DeepEqual(cf.defaults, expectedDefaults) {
+		t.Errorf("Expected defaults %v, got %v", expectedDefaults, cf.defaults)
+	}
+
+	expectedCI := map[string][]string{
+		"signal":         {"INT"},
+		"kill_after":     {"30"},
+		"kill_on_output": {"panic:", "stderr:#fatal"},
+	}
+	if !reflect.DeepEqual(cf.profiles["ci"], expectedCI) {
+		t.Errorf("Expected ci profile %v, got %v", expectedCI, cf.profiles["ci"])
+	}
+
+	if cf.profiles["slow runner"]["signal"][0] != "KILL" {
+		t.Errorf("Expected quoted profile name to be parsed, got %v", cf.profiles)
+	}
+}
+
+func TestParseConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"missing value", "verbose"},
+		{"missing key", "= true"},
+		{"bare word", "signal = INT"},
+		{"unterminated string", `signal = "INT`},
+		{"text after string", `signal = "INT" x`},
+		{"unterminated array", `kill_on_output = ["a"`},
+		{"array separator", `kill_on_output = ["a" "b"]`},
+		{"unknown table", "[defaults]"},
+		{"bad header", "[profile.ci"},
+		{"duplicate key", "verbose = true\nverbose = false"},
+		{"duplicate profile", "[profile.ci]\n[profile.ci]"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := parseConfigFile(strings.NewReader(test.input)); err == nil {
+				t.Errorf("Expected error for %q, but got none", test.input)
+			}
+		})
+	}
+}
+
+func TestApplyConfigPrecedence(t *testing.T) {
+	cf, err := parseConfigFile(strings.NewReader(`
+kill_after = "10s"
+signal = "HUP"
+verbose = true
+
+[profile.ci]
+signal = "INT"
+kill_on_output = ["panic:"]
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	fs := newTestFlagSet()
+	fs.Parse([]string{"--kill-after=1s", "5s", "true"})
+
+	if err := applyConfig(fs, cf, "ci"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"kill-after":     "1s",     // command line wins
+		"signal":         "INT",    // profile wins over defaults
+		"verbose":        "true",   // top-level default
+		"kill-on-output": "panic:", // arrays are applied per element
+	}
+	for name, value := range expected {
+		if got := fs.Lookup(name).Value.String(); got != value {
+			t.Errorf("Expected %s=%q, got %q", name, value, got)
+		}
+	}
+}
+
+func TestApplyConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		profile string
+	}{
+		{"unknown profile", "verbose = true", "ci"},
+		{"unknown setting", "colour = true", ""},
+		{"unconfigurable setting", "help = true", ""},
+		{"invalid bool", `verbose = "maybe"`, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cf, err := parseConfigFile(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatalf("Unexpected parse error: %v", err)
+			}
+			if err := applyConfig(newTestFlagSet(), cf, test.profile); err == nil {
+				t.Errorf("Expected error, but got none")
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte("[profile.ci]\nverbose = true\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	t.Setenv("TIMEOUT_CONFIG", path)
+
+	fs := newTestFlagSet()
+	if err := loadConfig(fs, "ci"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fs.Lookup("verbose").Value.String() != "true" {
+		t.Errorf("Expected profile to be applied")
+	}
+
+	// An explicitly named file must exist
+	t.Setenv("TIMEOUT_CONFIG", filepath.Join(t.TempDir(), "missing.toml"))
+	if err := loadConfig(newTestFlagSet(), ""); err == nil {
+		t.Errorf("Expected error for missing $TIMEOUT_CONFIG file")
+	}
+}
+
+func TestLoadConfigDefaultLocation(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TIMEOUT_CONFIG", "")
+	t.Setenv("XDG_CONFIG_HOME", dir)
+
+	// No file is fine unless a profile is requested
+	if err := loadConfig(newTestFlagSet(), ""); err != nil {
+		t.Errorf("Unexpected error without config file: %v", err)
+	}
+	if err := loadConfig(newTestFlagSet(), "ci"); err == nil {
+		t.Errorf("Expected error for profile without config file")
+	}
+
+	os.MkdirAll(filepath.Join(dir, "timeout"), 0755)
+	os.WriteFile(filepath.Join(dir, "timeout", "config.toml"), []byte(`signal = "KILL"`), 0644)
+
+	fs := newTestFlagSet()
+	if err := loadConfig(fs, ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fs.Lookup("signal").Value.String() != "KILL" {
+		t.Errorf("Expected config from $XDG_CONFIG_HOME to be applied")
+	}
+}
+
+func TestWriteEffectiveConfig(t *testing.T) {
+	fs := newTestFlagSet()
+	fs.Parse([]string{"--verbose", "--kill-on-output=a", "--kill-on-output=b\"c"})
+
+	var buf SafeBuffer
+	writeEffectiveConfig(&buf, fs)
+
+	expected := "kill_after = \"\"\nkill_on_output = [\"a\", \"b\\\"c\"]\nsignal = \"TERM\"\nverbose = true\n"
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	// The printed settings can be read back
+	if _, err := parseConfigFile(strings.NewReader(buf.String())); err != nil {
+		t.Errorf("Printed config does not parse: %v", err)
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	tests := map[string]string{
+		"signal":          "TIMEOUT_SIGNAL",
+		"kill-after":      "TIMEOUT_KILL_AFTER",
+		"preserve-status": "TIMEOUT_PRESERVE_STATUS",
+	}
+	for flagName, expected := range tests {
+		if got := envName(flagName); got != expected {
+			t.Errorf("For flag %q, expected %q, got %q", flagName, expected, got)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"TIMEOUT_SIGNAL":         "INT",
+		"TIMEOUT_KILL_AFTER":     "30s",
+		"TIMEOUT_VERBOSE":        "1",
+		"TIMEOUT_PROFILE":        "ci",
+		"TIMEOUT_HELP":           "true",
+		"TIMEOUT_KILL_ON_OUTPUT": "",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	fs := newTestFlagSet()
+	fs.Parse([]string{"--signal=HUP", "5s", "true"})
+
+	if err := applyEnv(fs, lookup); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"signal":         "HUP",  // command line wins
+		"kill-after":     "30s",  // from the environment
+		"verbose":        "true", // booleans accept strconv.ParseBool forms
+		"profile":        "ci",   // the profile can be chosen from the environment
+		"help":           "false",
+		"kill-on-output": "", // empty variables are ignored
+	}
+	for name, value := range expected {
+		if got := fs.Lookup(name).Value.String(); got != value {
+			t.Errorf("Expected %s=%q, got %q", name, value, got)
+		}
+	}
+}
+
+func TestApplyEnvInvalid(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		if name == "TIMEOUT_VERBOSE" {
+			return "sometimes", true
+		}
+		return "", false
+	}
+
+	err := applyEnv(newTestFlagSet(), lookup)
+	if err == nil || !strings.Contains(err.Error(), "TIMEOUT_VERBOSE") {
+		t.Errorf("Expected error naming TIMEOUT_VERBOSE, got %v", err)
+	}
+}
+
+func TestEnvPrecedenceOverConfig(t *testing.T) {
+	cf, err := parseConfigFile(strings.NewReader(`
+signal = "HUP"
+kill_after = "10s"
+
+[profile.ci]
+signal = "INT"
+verbose = true
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	lookup := func(name string) (string, bool) {
+		if name == "TIMEOUT_SIGNAL" {
+			return "QUIT", true
+		}
+		return "", false
+	}
+
+	// main applies the environment first, then the configuration file to
+	// whatever is still unset
+	fs := newTestFlagSet()
+	fs.Parse([]string{"--kill-after=1s", "5s", "true"})
+	if err := applyEnv(fs, lookup); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := applyConfig(fs, cf, "ci"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"kill-after": "1s",   // command line
+		"signal":     "QUIT", // environment over profile and defaults
+		"verbose":    "true", // profile
+	}
+	for name, value := range expected {
+		if got := fs.Lookup(name).Value.String(); got != value {
+			t.Errorf("Expected %s=%q, got %q", name, value, got)
+		}
+	}
+}
+
+func TestOptionalString(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{nil, ""},
+		{[]string{"--timestamps"}, "rfc3339"},
+		{[]string{"--timestamps=elapsed"}, "elapsed"},
+		{[]string{"--timestamps=elapsed", "--timestamps=false"}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(strings.Join(test.args, " "), func(t *testing.T) {
+			value := optionalString{implicit: "rfc3339"}
+			fs := flag.NewFlagSet("timeout", flag.ContinueOnError)
+			fs.Var(&value, "timestamps", "")
+			if err := fs.Parse(append(test.args, "10s")); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if value.value != test.expected {
+				t.Errorf("Expected %q, got %q", test.expected, value.value)
+			}
+			if fs.Arg(0) != "10s" {
+				t.Errorf("The flag should not consume the next argument, got %q", fs.Args())
+			}
+
+			// The printed setting can be read back
+			var buf SafeBuffer
+			writeEffectiveConfig(&buf, fs)
+			cf, err := parseConfigFile(strings.NewReader(buf.String()))
+			if err != nil {
+				t.Fatalf("Printed config does not parse: %v", err)
+			}
+			if err := applyConfig(fs, cf, ""); err != nil || value.value != test.expected {
+				t.Errorf("Round trip gave %q (%v), expected %q", value.value, err, test.expected)
+			}
+		})
+	}
+}
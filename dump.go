@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultDumpWait is how long the command is given to write its stack dump
+// when --dump-wait is not set
+const defaultDumpWait = 5 * time.Second
+
+// stackDump asks the command to dump its stacks before it is stopped
+type stackDump struct {
+	signal syscall.Signal
+	wait   time.Duration
+	file   string
+
+	// capture records the command's stderr while the dump is written
+	capture *dumpCapture
+}
+
+// parseStackDump builds the stack dump settings from config, scaling the
+// dump wait by scale. It returns nil when --dump-signal is not set.
+func parseStackDump(config Config, scale float64) (*stackDump, error) {
+	if config.DumpSignal == "" {
+		if config.DumpWait != "" || config.DumpFile != "" {
+			return nil, fmt.Errorf("--dump-wait and --dump-file require --dump-signal")
+		}
+		return nil, nil
+	}
+
+	sig, err := parseSignal(config.DumpSignal)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &stackDump{signal: sig, wait: defaultDumpWait, file: config.DumpFile}
+	if config.DumpWait != "" {
+		d.wait, err = parseDuration(config.DumpWait)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time interval '%s': %v", config.DumpWait, err)
+		}
+	}
+	d.wait = scaleOption(config, "dump-wait", d.wait, scale)
+	if d.file != "" {
+		d.capture = &dumpCapture{}
+	}
+	return d, nil
+}
+
+// dumpStack sends the dump signal and gives the command time to write its
+// dump. It reports whether the command exited while dumping.
+func (e *execution) dumpStack() bool {
+	config := e.config
+	d := e.dump
+
+	e.log.Info(fmt.Sprintf("sending signal %s to command '%s' for a stack dump", formatSignal(d.signal), e.command),
+		"event", "dump", "command", e.command, "pid", e.proc.Pid(), "signal", formatSignal(d.signal))
+
+	if d.capture != nil {
+		d.capture.start()
+	}
+	if err := e.sendSignal(d.signal); err != nil {
+		e.log.Info(fmt.Sprintf("failed to send signal: %v", err),
+			"event", "error", "command", e.command, "error", err)
+	}
+
+	timer := config.Clock.NewTimer(d.wait)
+	defer timer.Stop()
+
+	exited := false
+	select {
+	case <-timer.C():
+	case <-e.done:
+		// The command exited after dumping, as Go programs do on QUIT
+		exited = true
+	}
+
+	if d.capture != nil {
+		if err := os.WriteFile(d.file, d.capture.stop(), 0644); err != nil {
+			e.log.Error(fmt.Sprintf("cannot write stack dump: %v", err),
+				"event", "error", "command", e.command, "error", err)
+		} else {
+			e.dumpFile = d.file
+			e.log.Info(fmt.Sprintf("saved stack dump of command '%s' to %s", e.command, d.file),
+				"event", "dump-saved", "command", e.command, "file", d.file)
+		}
+	}
+	return exited
+}
+
+// dumpCapture records stderr output written between start and stop
+type dumpCapture struct {
+	mu     sync.Mutex
+	active bool
+	buf    bytes.Buffer
+}
+
+func (c *dumpCapture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.active {
+		c.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+func (c *dumpCapture) start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.active = true
+}
+
+// stop ends the capture and returns what was recorded
+func (c *dumpCapture) stop() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.active = false
+	return c.buf.Bytes()
+}
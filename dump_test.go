@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseStackDump(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		expected *stackDump
+		hasError bool
+	}{
+		{"disabled", Config{}, nil, false},
+		{"defaults", Config{DumpSignal: "QUIT"}, &stackDump{signal: syscall.SIGQUIT, wait: defaultDumpWait}, false},
+		{"custom wait", Config{DumpSignal: "USR1", DumpWait: "2s"}, &stackDump{signal: syscall.SIGUSR1, wait: 2 * time.Second}, false},
+
+		{"invalid signal", Config{DumpSignal: "BOGUS"}, nil, true},
+		{"invalid wait", Config{DumpSignal: "QUIT", DumpWait: "later"}, nil, true},
+		{"wait without signal", Config{DumpWait: "2s"}, nil, true},
+		{"file without signal", Config{DumpFile: "dump.txt"}, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := parseStackDump(test.config, 1)
+
+			if test.hasError {
+				if err == nil {
+					t.Errorf("Expected error, but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+
+			if !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("Expected %+v, got %+v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestDumpCapture(t *testing.T) {
+	var c dumpCapture
+	c.Write([]byte("before\n"))
+	c.start()
+	c.Write([]byte("goroutine 1 [running]:\n"))
+	dump := string(c.stop())
+	c.Write([]byte("after\n"))
+
+	if dump != "goroutine 1 [running]:\n" {
+		t.Errorf("Expected only the output written while capturing, got %q", dump)
+	}
+}
+
+func TestRunTimeoutDumpExits(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	path := filepath.Join(t.TempDir(), "dump.txt")
+	config := Config{
+		SignalName: "TERM",
+		Verbose:    true,
+		DumpSignal: "QUIT",
+		DumpWait:   "5s",
+		DumpFile:   path,
+		Stdout:     &stdout,
+		Stderr:     &stderr,
+	}
+
+	// Behave like a Go program: dump on QUIT, then exit with status 2. The
+	// loop has no child for the QUIT sent to the group to kill noisily.
+	script := "trap 'echo goroutine 1 [running]: >&2; exit 2' QUIT; echo started >&2; while :; do :; done"
+	start := time.Now()
+	result := runTimeout(config, []string{"0.2s", "sh", "-c", script})
+
+	if result.ExitCode != 124 {
+		t.Errorf("Expected exit code 124, got %d", result.ExitCode)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Should not wait the full dump-wait once the command exits, took %v", elapsed)
+	}
+	if !reflect.DeepEqual(result.Signals, []string{"QUIT"}) {
+		t.Errorf("Expected only QUIT to be sent, got %q", result.Signals)
+	}
+	if result.DumpFile != path {
+		t.Errorf("Expected dump file %q in result, got %q", path, result.DumpFile)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read dump file: %v", err)
+	}
+	if string(data) != "goroutine 1 [running]:\n" {
+		t.Errorf("Unexpected dump contents: %q", data)
+	}
+	if !strings.Contains(stderr.String(), "saved stack dump") {
+		t.Errorf("Verbose output should note the saved dump, got %q", stderr.String())
+	}
+}
+
+func TestRunTimeoutDumpThenEscalate(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName: "TERM",
+		DumpSignal: "QUIT",
+		DumpWait:   "0.2s",
+		Stdout:     &stdout,
+		Stderr:     &stderr,
+	}
+
+	// Dump on QUIT but keep running, so the timeout signal is still needed
+	script := "trap 'echo dumping >&2' QUIT; while :; do sleep 0.05; done"
+	result := runTimeout(config, []string{"0.2s", "sh", "-c", script})
+
+	if result.ExitCode != 124 {
+		t.Errorf("Expected exit code 124, got %d", result.ExitCode)
+	}
+	if !reflect.DeepEqual(result.Signals, []string{"QUIT", "TERM"}) {
+		t.Errorf("Expected QUIT then TERM, got %q", result.Signals)
+	}
+	if !strings.Contains(stderr.String(), "dumping") {
+		t.Errorf("Dump output should pass through to stderr, got %q", stderr.String())
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// exitMapping rewrites timeout's exit status for --timeout-exit-code,
+// --kill-exit-code and --map-exit
+type exitMapping struct {
+	timeout int // -1 when not set
+	kill    int // -1 when not set
+	rules   map[int]int
+}
+
+// parseExitMapping parses the exit status options. It returns nil when
+// none is set.
+func parseExitMapping(config Config) (*exitMapping, error) {
+	if config.TimeoutExitCode == "" && config.KillExitCode == "" && config.MapExit == "" {
+		return nil, nil
+	}
+
+	m := &exitMapping{timeout: -1, kill: -1, rules: map[int]int{}}
+	var err error
+	if config.TimeoutExitCode != "" {
+		if m.timeout, err = parseExitCode(config.TimeoutExitCode); err != nil {
+			return nil, err
+		}
+	}
+	if config.KillExitCode != "" {
+		if m.kill, err = parseExitCode(config.KillExitCode); err != nil {
+			return nil, err
+		}
+	}
+	if config.MapExit != "" {
+		for _, rule := range strings.Split(config.MapExit, ",") {
+			from, to, ok := strings.Cut(strings.TrimSpace(rule), ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid exit code mapping '%s'", rule)
+			}
+			f, err := parseExitCode(from)
+			if err != nil {
+				return nil, fmt.Errorf("invalid exit code mapping '%s': %v", rule, err)
+			}
+			t, err := parseExitCode(to)
+			if err != nil {
+				return nil, fmt.Errorf("invalid exit code mapping '%s': %v", rule, err)
+			}
+			if _, dup := m.rules[f]; dup {
+				return nil, fmt.Errorf("exit code %d is mapped more than once", f)
+			}
+			m.rules[f] = t
+		}
+	}
+	return m, nil
+}
+
+// parseExitCode parses an exit status between 0 and 255
+func parseExitCode(s string) (int, error) {
+	code, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || code < 0 || code > 255 {
+		return 0, fmt.Errorf("invalid exit code '%s'", s)
+	}
+	return code, nil
+}
+
+// apply maps the exit status of result. --kill-exit-code applies when
+// timeout had to send KILL to stop the command, --timeout-exit-code when it
+// stopped the command otherwise, and --map-exit to any other status.
+func (m *exitMapping) apply(result Result) Result {
+	code := result.ExitCode
+	stopped := stoppedByTimeout(result.Reason) && (code == 124 || code == 128+9)
+
+	switch {
+	case stopped && m.kill >= 0 && slices.Contains(result.Signals, "KILL"):
+		code = m.kill
+	case stopped && m.timeout >= 0:
+		code = m.timeout
+	default:
+		if to, ok := m.rules[code]; ok {
+			code = to
+		}
+	}
+
+	if code != result.ExitCode {
+		result.OriginalExitCode = result.ExitCode
+		result.Remapped = true
+		result.ExitCode = code
+	}
+	return result
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseExitMapping(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		hasError bool
+	}{
+		{"none", Config{}, false},
+		{"timeout code", Config{TimeoutExitCode: "75"}, false},
+		{"kill code", Config{KillExitCode: "0"}, false},
+		{"rules", Config{MapExit: "124:75, 137:75,1:0"}, false},
+		{"timeout code too large", Config{TimeoutExitCode: "256"}, true},
+		{"negative kill code", Config{KillExitCode: "-1"}, true},
+		{"not a number", Config{TimeoutExitCode: "soft"}, true},
+		{"rule without colon", Config{MapExit: "124"}, true},
+		{"rule with bad target", Config{MapExit: "124:x"}, true},
+		{"rule with bad source", Config{MapExit: "300:1"}, true},
+		{"empty rule", Config{MapExit: "124:75,"}, true},
+		{"duplicate rule", Config{MapExit: "124:75,124:1"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseExitMapping(tt.config)
+			if tt.hasError && err == nil {
+				t.Errorf("Expected error for %+v", tt.config)
+			}
+			if !tt.hasError && err != nil {
+				t.Errorf("Unexpected error for %+v: %v", tt.config, err)
+			}
+		})
+	}
+}
+
+func TestExitMappingApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		result   Result
+		expected int
+	}{
+		{"timeout", Config{TimeoutExitCode: "75"}, Result{ExitCode: 124, Reason: ReasonTimeout, Signals: []string{"TERM"}}, 75},
+		{"kill-after without kill code", Config{TimeoutExitCode: "75"}, Result{ExitCode: 124, Reason: ReasonTimeout, Signals: []string{"TERM", "KILL"}}, 75},
+		{"kill-after", Config{TimeoutExitCode: "75", KillExitCode: "76"}, Result{ExitCode: 124, Reason: ReasonTimeout, Signals: []string{"TERM", "KILL"}}, 76},
+		{"kill signal", Config{KillExitCode: "76"}, Result{ExitCode: 137, Reason: ReasonTimeout, Signals: []string{"KILL"}}, 76},
+		{"kill code without kill", Config{KillExitCode: "76"}, Result{ExitCode: 124, Reason: ReasonTimeout, Signals: []string{"TERM"}}, 124},
+		{"deadline", Config{TimeoutExitCode: "1"}, Result{ExitCode: 124, Reason: ReasonDeadline}, 1},
+		{"completed with 124", Config{TimeoutExitCode: "75"}, Result{ExitCode: 124, Reason: ReasonCompleted}, 124},
+		{"rule", Config{MapExit: "124:1"}, Result{ExitCode: 124, Reason: ReasonTimeout}, 1},
+		{"timeout code before rule", Config{TimeoutExitCode: "75", MapExit: "124:1"}, Result{ExitCode: 124, Reason: ReasonTimeout}, 75},
+		{"rule for command status", Config{MapExit: "3:0"}, Result{ExitCode: 3, Reason: ReasonCompleted}, 0},
+		{"no matching rule", Config{MapExit: "3:0"}, Result{ExitCode: 4, Reason: ReasonCompleted}, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := parseExitMapping(tt.config)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			got := m.apply(tt.result)
+			if got.ExitCode != tt.expected {
+				t.Errorf("Expected exit code %d, got %d", tt.expected, got.ExitCode)
+			}
+			remapped := tt.expected != tt.result.ExitCode
+			if got.Remapped != remapped || (remapped && got.OriginalExitCode != tt.result.ExitCode) {
+				t.Errorf("Expected original exit code %d (remapped %v), got %d (remapped %v)",
+					tt.result.ExitCode, remapped, got.OriginalExitCode, got.Remapped)
+			}
+		})
+	}
+}
+
+func TestRunTimeoutMapExit(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	path := filepath.Join(t.TempDir(), "report.json")
+	config := Config{
+		SignalName: "TERM",
+		MapExit:    "7:0",
+		Report:     path,
+		Stdout:     &stdout,
+		Stderr:     &stderr,
+	}
+
+	result := runTimeout(config, []string{"5s", "sh", "-c", "exit 7"})
+	if result.ExitCode != 0 {
+		t.Errorf("Expected exit code 0, got %d", result.ExitCode)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	var got jsonReport
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Report is not valid JSON: %v", err)
+	}
+	if got.ExitCode != 0 || got.Original == nil || *got.Original != 7 {
+		t.Errorf("Expected exit code 0 mapped from 7, got %s", data)
+	}
+}
+
+func TestRunTimeoutTimeoutExitCode(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", TimeoutExitCode: "75", Stdout: &stdout, Stderr: &stderr}
+	clock := newFakeClock()
+	proc := newFakeProcess(exitOn(-1, syscall.SIGTERM))
+
+	results := runFake(config, clock, proc, []string{"10s", "server"})
+	clock.WaitForTimers(t, 1)
+	clock.Advance(10 * time.Second)
+	result := waitResult(t, results)
+	if result.ExitCode != 75 || result.OriginalExitCode != 124 {
+		t.Errorf("Expected exit code 75 mapped from 124, got %d from %d", result.ExitCode, result.OriginalExitCode)
+	}
+}
+
+func TestRunTimeoutInvalidExitMapping(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName: "TERM",
+		MapExit:    "124",
+		Stdout:     &stdout,
+		Stderr:     &stderr,
+	}
+
+	result := runTimeout(config, []string{"5s", "true"})
+	if result.ExitCode != 125 {
+		t.Errorf("Expected exit code 125, got %d", result.ExitCode)
+	}
+	if !strings.Contains(stderr.String(), "invalid exit code mapping") {
+		t.Errorf("Expected invalid mapping error, got %q", stderr.String())
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultHookLimit bounds a hook command when no limit is given
+const defaultHookLimit = 30 * time.Second
+
+// HookResult records a hook command run by timeout
+type HookResult struct {
+	ExitCode int
+	Output   string
+	Error    error
+}
+
+// runHook runs script with sh, adding env to the environment. Its combined
+// output is copied to w and recorded; it is killed once limit has elapsed.
+func runHook(script string, env []string, limit time.Duration, w io.Writer) *HookResult {
+	ctx := context.Background()
+	if limit > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limit)
+		defer cancel()
+	}
+
+	var output hookOutput
+	cmd := exec.CommandContext(ctx, "sh", "-c", script)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = tee(w, &output)
+	cmd.Stderr = cmd.Stdout
+	// Do not wait on descendants still holding the output pipe
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	result := &HookResult{Output: output.String()}
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		result.Error = fmt.Errorf("hook exceeded its limit of %s", limit)
+	} else if _, ok := err.(*exec.ExitError); !ok && err != nil {
+		result.Error = err
+		result.ExitCode = -1
+	}
+	return result
+}
+
+// hookOutput is a bytes.Buffer safe for the concurrent writes of a command's
+// stdout and stderr
+type hookOutput struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *hookOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.Write(p)
+}
+
+func (o *hookOutput) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String()
+}
+
+// runTimeoutHook runs the --on-timeout command against the still running
+// command before it is signalled
+func (e *execution) runTimeoutHook() {
+	config := e.config
+	pid := e.proc.Pid()
+	env := []string{
+		"TIMEOUT_PID=" + strconv.Itoa(pid),
+		"TIMEOUT_ELAPSED=" + formatSeconds(e.elapsed()),
+	}
+	// Only a group of the command's own, never timeout's, is safe to signal
+	if pgid, err := syscall.Getpgid(pid); err == nil && pgid != syscall.Getpgrp() {
+		env = append(env, "TIMEOUT_PGID="+strconv.Itoa(pgid))
+	}
+
+	e.log.Info(fmt.Sprintf("running on-timeout command for command '%s'", e.command),
+		"event", "on-timeout", "command", e.command, "hook", config.OnTimeout)
+	e.onTimeout = runHook(config.OnTimeout, env, e.onTimeoutLimit, config.Stderr)
+	logHook(e.log, "on-timeout", e.onTimeout)
+}
+
+// logHook logs how the named hook command ended
+func logHook(log *slog.Logger, name string, hook *HookResult) {
+	if hook.Error != nil {
+		log.Info(fmt.Sprintf("%s command failed: %v", name, hook.Error),
+			"event", name+"-done", "error", hook.Error)
+		return
+	}
+	log.Info(fmt.Sprintf("%s command exited with status %d", name, hook.ExitCode),
+		"event", name+"-done", "exit_code", hook.ExitCode)
+}
+
+// formatSeconds formats d as decimal seconds, e.g. "30.25"
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
+
+// runExitHook runs the --on-exit command once the command has been reaped
+func runExitHook(config Config, result Result) *HookResult {
+	env := []string{
+		"TIMEOUT_EXIT_CODE=" + strconv.Itoa(result.ExitCode),
+		"TIMEOUT_REASON=" + result.Reason,
+		"TIMEOUT_DURATION=" + formatSeconds(result.Elapsed),
+	}
+	if config.Report != "" {
+		env = append(env, "TIMEOUT_REPORT_PATH="+config.Report)
+	}
+
+	hook := runHook(config.OnExit, env, defaultHookLimit, config.Stderr)
+	logHook(loggerFor(config), "on-exit", hook)
+	return hook
+}
+
+// hookFailed reports whether hook did not run to a successful exit
+func hookFailed(hook *HookResult) bool {
+	return hook.Error != nil || hook.ExitCode != 0
+}
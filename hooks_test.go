@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunHook(t *testing.T) {
+	var stderr SafeBuffer
+	result := runHook("echo $GREETING; echo oops >&2; exit 3", []string{"GREETING=hello"}, time.Second, &stderr)
+
+	if result.ExitCode != 3 {
+		t.Errorf("Expected exit code 3, got %d", result.ExitCode)
+	}
+	if result.Error != nil {
+		t.Errorf("Unexpected error: %v", result.Error)
+	}
+	if !strings.Contains(result.Output, "hello\n") || !strings.Contains(result.Output, "oops\n") {
+		t.Errorf("Expected combined output to be recorded, got %q", result.Output)
+	}
+	if stderr.String() != result.Output {
+		t.Errorf("Expected output to be copied to stderr, got %q", stderr.String())
+	}
+}
+
+func TestRunHookLimit(t *testing.T) {
+	var stderr SafeBuffer
+	start := time.Now()
+	result := runHook("sleep 5", nil, 100*time.Millisecond, &stderr)
+
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Hook should be killed at its limit, took %v", elapsed)
+	}
+	if result.Error == nil || !strings.Contains(result.Error.Error(), "limit") {
+		t.Errorf("Expected limit error, got %v", result.Error)
+	}
+}
+
+func TestFormatSeconds(t *testing.T) {
+	if s := formatSeconds(1500 * time.Millisecond); s != "1.5" {
+		t.Errorf("Expected 1.5, got %q", s)
+	}
+	if s := formatSeconds(30 * time.Second); s != "30" {
+		t.Errorf("Expected 30, got %q", s)
+	}
+}
+
+func TestRunTimeoutOnTimeout(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName: "TERM",
+		OnTimeout:  `kill -0 "$TIMEOUT_PID" && echo "alive pgid=$TIMEOUT_PGID elapsed=$TIMEOUT_ELAPSED"`,
+		Stdout:     &stdout,
+		Stderr:     &stderr,
+	}
+
+	result := runTimeout(config, []string{"0.2s", "sleep", "5"})
+
+	if result.ExitCode != 124 {
+		t.Errorf("Expected exit code 124, got %d", result.ExitCode)
+	}
+	if result.OnTimeout == nil {
+		t.Fatalf("Expected on-timeout hook result")
+	}
+	if result.OnTimeout.ExitCode != 0 {
+		t.Errorf("Hook should see the command still running, got exit code %d: %q", result.OnTimeout.ExitCode, result.OnTimeout.Output)
+	}
+	if !strings.HasPrefix(result.OnTimeout.Output, "alive pgid=") || strings.Contains(result.OnTimeout.Output, "elapsed=\n") {
+		t.Errorf("Unexpected hook output: %q", result.OnTimeout.Output)
+	}
+	// The command leads a process group of its own, never timeout's
+	if strings.Contains(result.OnTimeout.Output, "pgid= ") || strings.Contains(result.OnTimeout.Output, fmt.Sprintf("pgid=%d ", syscall.Getpgrp())) {
+		t.Errorf("Hook should see the command's own process group, got %q", result.OnTimeout.Output)
+	}
+	if !reflect.DeepEqual(result.Signals, []string{"TERM"}) {
+		t.Errorf("Expected TERM after the hook, got %q", result.Signals)
+	}
+	if strings.Contains(stdout.String(), "alive") {
+		t.Errorf("Hook output should not be mixed into the command's stdout")
+	}
+}
+
+func TestRunTimeoutOnTimeoutNotRunOnSuccess(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName: "TERM",
+		OnTimeout:  "echo hook",
+		Stdout:     &stdout,
+		Stderr:     &stderr,
+	}
+
+	result := runTimeout(config, []string{"5s", "true"})
+
+	if result.OnTimeout != nil {
+		t.Errorf("Hook should only run on timeout")
+	}
+}
+
+func TestRunTimeoutOnTimeoutInvalidLimit(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName:     "TERM",
+		OnTimeout:      "true",
+		OnTimeoutLimit: "never",
+		Stdout:         &stdout,
+		Stderr:         &stderr,
+	}
+
+	result := runTimeout(config, []string{"5s", "true"})
+
+	if result.ExitCode != 125 {
+		t.Errorf("Expected exit code 125 for invalid limit, got %d", result.ExitCode)
+	}
+}
+
+func TestRunTimeoutOnExit(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	report := filepath.Join(t.TempDir(), "report.json")
+	config := Config{
+		SignalName: "TERM",
+		Report:     report,
+		OnExit:     `echo "code=$TIMEOUT_EXIT_CODE reason=$TIMEOUT_REASON"; test -n "$TIMEOUT_DURATION" && grep -q exit_code "$TIMEOUT_REPORT_PATH"`,
+		Stdout:     &stdout,
+		Stderr:     &stderr,
+	}
+
+	result := runTimeout(config, []string{"0.2s", "sleep", "5"})
+
+	if result.ExitCode != 124 {
+		t.Errorf("Expected exit code 124, got %d", result.ExitCode)
+	}
+	if result.OnExit == nil {
+		t.Fatalf("Expected on-exit hook result")
+	}
+	if result.OnExit.ExitCode != 0 {
+		t.Errorf("Hook should find the report, got exit code %d", result.OnExit.ExitCode)
+	}
+	if result.OnExit.Output != "code=124 reason=timeout\n" {
+		t.Errorf("Unexpected hook output: %q", result.OnExit.Output)
+	}
+}
+
+func TestRunTimeoutOnExitFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		strict   bool
+		args     []string
+		expected int
+	}{
+		{"lenient", false, []string{"5s", "true"}, 0},
+		{"strict", true, []string{"5s", "true"}, 125},
+		{"strict keeps command failure", true, []string{"5s", "sh", "-c", "exit 3"}, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr SafeBuffer
+			config := Config{
+				SignalName:   "TERM",
+				OnExit:       "exit 1",
+				OnExitStrict: test.strict,
+				Stdout:       &stdout,
+				Stderr:       &stderr,
+			}
+
+			result := runTimeout(config, test.args)
+
+			if result.ExitCode != test.expected {
+				t.Errorf("Expected exit code %d, got %d", test.expected, result.ExitCode)
+			}
+		})
+	}
+}
+
+func TestRunTimeoutOnExitStartFailure(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName: "TERM",
+		OnExit:     `echo "$TIMEOUT_REASON"`,
+		Stdout:     &stdout,
+		Stderr:     &stderr,
+	}
+
+	result := runTimeout(config, []string{"5s", "nonexistent-command-xyz"})
+
+	if result.OnExit == nil || result.OnExit.Output != "error\n" {
+		t.Errorf("Expected hook to run with reason error, got %+v", result.OnExit)
+	}
+}
@@ -14,7 +14,7 @@ import (
 
 func TestTimeoutIntegration(t *testing.T) {
 	// Build the timeout binary first
-	buildCmd := exec.Command("go", "build", "-o", "timeout_test", "timeout.go")
+	buildCmd := exec.Command("go", "build", "-o", "timeout_test", ".")
 	if err := buildCmd.Run(); err != nil {
 		t.Fatalf("Failed to build timeout binary: %v", err)
 	}
@@ -86,7 +86,7 @@ func TestTimeoutIntegration(t *testing.T) {
 }
 
 func TestTimeoutHelp(t *testing.T) {
-	buildCmd := exec.Command("go", "build", "-o", "timeout_test", "timeout.go")
+	buildCmd := exec.Command("go", "build", "-o", "timeout_test", ".")
 	if err := buildCmd.Run(); err != nil {
 		t.Fatalf("Failed to build timeout binary: %v", err)
 	}
@@ -119,7 +119,7 @@ func TestTimeoutHelp(t *testing.T) {
 }
 
 func TestTimeoutVersion(t *testing.T) {
-	buildCmd := exec.Command("go", "build", "-o", "timeout_test", "timeout.go")
+	buildCmd := exec.Command("go", "build", "-o", "timeout_test", ".")
 	if err := buildCmd.Run(); err != nil {
 		t.Fatalf("Failed to build timeout binary: %v", err)
 	}
@@ -140,7 +140,7 @@ func TestTimeoutVersion(t *testing.T) {
 }
 
 func TestTimeoutInvalidArgs(t *testing.T) {
-	buildCmd := exec.Command("go", "build", "-o", "timeout_test", "timeout.go")
+	buildCmd := exec.Command("go", "build", "-o", "timeout_test", ".")
 	if err := buildCmd.Run(); err != nil {
 		t.Fatalf("Failed to build timeout binary: %v", err)
 	}
@@ -178,7 +178,7 @@ func TestTimeoutInvalidArgs(t *testing.T) {
 }
 
 func TestTimeoutWithSignal(t *testing.T) {
-	buildCmd := exec.Command("go", "build", "-o", "timeout_test", "timeout.go")
+	buildCmd := exec.Command("go", "build", "-o", "timeout_test", ".")
 	if err := buildCmd.Run(); err != nil {
 		t.Fatalf("Failed to build timeout binary: %v", err)
 	}
@@ -210,7 +210,7 @@ func TestTimeoutWithSignal(t *testing.T) {
 }
 
 func TestTimeoutPreserveStatus(t *testing.T) {
-	buildCmd := exec.Command("go", "build", "-o", "timeout_test", "timeout.go")
+	buildCmd := exec.Command("go", "build", "-o", "timeout_test", ".")
 	if err := buildCmd.Run(); err != nil {
 		t.Fatalf("Failed to build timeout binary: %v", err)
 	}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// logKeep is how many rotated logs are kept, as FILE.1.gz to FILE.5.gz
+const logKeep = 5
+
+// sizeUnits maps the suffixes accepted by parseSize to their multiplier
+var sizeUnits = map[string]int64{
+	"":  1,
+	"B": 1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+}
+
+// parseSize parses a SIZE such as "512", "64K" or "1.5G". Suffixes are
+// powers of 1024 and may be followed by "B" or "iB".
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := 0
+	for i < len(s) && (isDigit(s[i]) || s[i] == '.') {
+		i++
+	}
+	number, unit := s[:i], strings.ToUpper(s[i:])
+	switch {
+	case len(unit) == 3 && strings.HasSuffix(unit, "IB"):
+		unit = unit[:1]
+	case len(unit) == 2 && strings.HasSuffix(unit, "B"):
+		unit = unit[:1]
+	}
+
+	multiplier, ok := sizeUnits[unit]
+	if number == "" || !ok {
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n*float64(multiplier) > float64(1<<62) {
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// outputFiles holds the log files the command's output is written to
+type outputFiles struct {
+	stdout   *rotatingFile
+	stderr   *rotatingFile
+	combined *rotatingFile
+	tee      bool
+}
+
+// openOutputFiles opens the --stdout-file, --stderr-file and --combined-file
+// logs. It returns nil when none is set.
+func openOutputFiles(config Config) (*outputFiles, error) {
+	if config.StdoutFile == "" && config.StderrFile == "" && config.CombinedFile == "" {
+		if config.Tee || config.MaxLogSize != "" {
+			return nil, fmt.Errorf("--tee and --max-log-size require a log file")
+		}
+		return nil, nil
+	}
+	if config.StdoutFile != "" && samePath(config.StdoutFile, config.StderrFile) {
+		return nil, fmt.Errorf("use --combined-file to write both streams to '%s'", config.StdoutFile)
+	}
+	for _, path := range []string{config.StdoutFile, config.StderrFile} {
+		if path != "" && samePath(path, config.CombinedFile) {
+			return nil, fmt.Errorf("'%s' is already the --combined-file", path)
+		}
+	}
+
+	var maxSize int64
+	if config.MaxLogSize != "" {
+		n, err := parseSize(config.MaxLogSize)
+		if err != nil {
+			return nil, err
+		}
+		maxSize = n
+	}
+
+	f := &outputFiles{tee: config.Tee}
+	for _, log := range []struct {
+		path string
+		file **rotatingFile
+	}{
+		{config.StdoutFile, &f.stdout},
+		{config.StderrFile, &f.stderr},
+		{config.CombinedFile, &f.combined},
+	} {
+		if log.path == "" {
+			continue
+		}
+		rf, err := openRotatingFile(log.path, maxSize)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		*log.file = rf
+	}
+	return f, nil
+}
+
+// samePath reports whether two log paths name the same file
+func samePath(a, b string) bool {
+	return a != "" && b != "" && filepath.Clean(a) == filepath.Clean(b)
+}
+
+// writers returns where the command's stdout and stderr go: the log files,
+// plus stdout and stderr themselves with --tee or for a stream without a log
+func (f *outputFiles) writers(stdout, stderr io.Writer) (io.Writer, io.Writer) {
+	if f == nil {
+		return stdout, stderr
+	}
+	return f.writer(stdout, f.stdout), f.writer(stderr, f.stderr)
+}
+
+func (f *outputFiles) writer(terminal io.Writer, file *rotatingFile) io.Writer {
+	var ws []io.Writer
+	if terminal != nil && (f.tee || (file == nil && f.combined == nil)) {
+		ws = append(ws, terminal)
+	}
+	if file != nil {
+		ws = append(ws, file)
+	}
+	if f.combined != nil {
+		ws = append(ws, f.combined)
+	}
+	if len(ws) == 1 {
+		return ws[0]
+	}
+	return io.MultiWriter(ws...)
+}
+
+// Close closes the log files and returns the first error met writing them
+func (f *outputFiles) Close() error {
+	if f == nil {
+		return nil
+	}
+	var first error
+	for _, rf := range []*rotatingFile{f.stdout, f.stderr, f.combined} {
+		if rf == nil {
+			continue
+		}
+		if err := rf.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// rotatingFile is a log file that is compressed and replaced by an empty
+// one before it would grow past maxSize. Write errors are remembered and
+// returned by Close rather than interrupting the command's output.
+type rotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	file    *os.File
+	size    int64
+	err     error
+
+	// compressing is done once the last rotated log is compressed, with
+	// compressErr set if that failed
+	compressing sync.WaitGroup
+	compressErr error
+}
+
+// openRotatingFile opens the log at path, appending to what earlier runs
+// left in it
+func openRotatingFile(path string, maxSize int64) (*rotatingFile, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open log: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("cannot open log: %v", err)
+	}
+	return &rotatingFile{path: path, maxSize: maxSize, file: file, size: info.Size()}, nil
+}
+
+// Write writes p, rotating the log as often as needed to keep each file
+// within maxSize. Output is split at the last line that fits, or mid-line
+// when a single line is longer than maxSize.
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := len(p)
+	for len(p) > 0 && f.err == nil {
+		chunk := p
+		if f.maxSize > 0 && f.size+int64(len(p)) > f.maxSize {
+			cut := 0
+			if room := f.maxSize - f.size; room > 0 {
+				if i := bytes.LastIndexByte(p[:room], '\n'); i >= 0 {
+					cut = i + 1
+				} else if f.size == 0 {
+					cut = int(room)
+				}
+			}
+			if cut == 0 {
+				f.err = f.rotate()
+				continue
+			}
+			chunk = p[:cut]
+		}
+		written, err := f.file.Write(chunk)
+		f.size += int64(written)
+		f.err = err
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+// rotate shifts the rotated logs up by one, moves the current log aside
+// and starts a new one. The old log is compressed to FILE.1.gz in the
+// background, so the command's output is not held up meanwhile.
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	// The previous rotation must be done with FILE.1.gz before it moves
+	f.compressing.Wait()
+	if f.compressErr != nil {
+		return f.compressErr
+	}
+
+	os.Remove(rotatedName(f.path, logKeep))
+	for i := logKeep - 1; i >= 1; i-- {
+		if err := os.Rename(rotatedName(f.path, i), rotatedName(f.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	old := f.path + ".1"
+	if err := os.Rename(f.path, old); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	f.file = file
+	f.size = 0
+
+	f.compressing.Add(1)
+	go func() {
+		defer f.compressing.Done()
+		if f.compressErr = compressFile(old, rotatedName(f.path, 1)); f.compressErr == nil {
+			os.Remove(old)
+		}
+	}()
+	return nil
+}
+
+// Close closes the log and returns the first error met writing it
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.file.Close(); err != nil && f.err == nil {
+		f.err = err
+	}
+	f.compressing.Wait()
+	if f.compressErr != nil && f.err == nil {
+		f.err = f.compressErr
+	}
+	if f.err != nil {
+		return fmt.Errorf("cannot write log %s: %v", f.path, f.err)
+	}
+	return nil
+}
+
+// rotatedName returns the name of the i-th most recent rotated log
+func rotatedName(path string, i int) string {
+	return path + "." + strconv.Itoa(i) + ".gz"
+}
+
+// compressFile writes a gzip copy of src to dst
+func compressFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+		hasError bool
+	}{
+		{"0", 0, false},
+		{"512", 512, false},
+		{"512B", 512, false},
+		{"64K", 64 << 10, false},
+		{"64k", 64 << 10, false},
+		{"64KB", 64 << 10, false},
+		{"64KiB", 64 << 10, false},
+		{"1.5M", 3 << 19, false},
+		{"2G", 2 << 30, false},
+		{"1T", 1 << 40, false},
+
+		{"", 0, true},
+		{"K", 0, true},
+		{"10X", 0, true},
+		{"10IB", 0, true},
+		{"1.2.3M", 0, true},
+		{"-5M", 0, true},
+		{"99999999T", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			result, err := parseSize(test.input)
+
+			if test.hasError {
+				if err == nil {
+					t.Errorf("Expected error, but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+
+			if result != test.expected {
+				t.Errorf("Expected %d, got %d", test.expected, result)
+			}
+		})
+	}
+}
+
+// readGzip returns the decompressed contents of path
+func readGzip(t *testing.T, path string) string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Invalid gzip %s: %v", path, err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	f, err := openRotatingFile(path, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, chunk := range []string{"aaaaaa\n", "bbbbbb\n", "cc\n", "dddddd\n"} {
+		f.Write([]byte(chunk))
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	current, _ := os.ReadFile(path)
+	if string(current) != "dddddd\n" {
+		t.Errorf("Expected the current log to hold the last write, got %q", current)
+	}
+	if got := readGzip(t, path+".1.gz"); got != "bbbbbb\ncc\n" {
+		t.Errorf("Expected the newest rotated log to hold 'bbbbbb\\ncc\\n', got %q", got)
+	}
+	if got := readGzip(t, path+".2.gz"); got != "aaaaaa\n" {
+		t.Errorf("Expected the oldest rotated log to hold 'aaaaaa\\n', got %q", got)
+	}
+	if _, err := os.Stat(path + ".1"); err == nil {
+		t.Errorf("Expected the uncompressed rotated log to be removed")
+	}
+}
+
+func TestRotatingFileLargeWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	f, err := openRotatingFile(path, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// One write larger than the limit is split at the last line that fits,
+	// and a line longer than the limit is split mid-line
+	f.Write([]byte("aaaa\nbbbb\ncccccccccccccc\nd\n"))
+	if err := f.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	current, _ := os.ReadFile(path)
+	if string(current) != "cccc\nd\n" {
+		t.Errorf("Expected the current log to hold 'cccc\\nd\\n', got %q", current)
+	}
+	for i, expected := range []string{"cccccccccc", "aaaa\nbbbb\n"} {
+		if got := readGzip(t, rotatedName(path, i+1)); got != expected {
+			t.Errorf("Expected rotated log %d to hold %q, got %q", i+1, expected, got)
+		}
+	}
+}
+
+func TestRotatingFileAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	if err := os.WriteFile(path, []byte("earlier\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := openRotatingFile(path, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The earlier run's output counts towards the limit
+	f.Write([]byte("later\n"))
+	if err := f.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	current, _ := os.ReadFile(path)
+	if string(current) != "later\n" {
+		t.Errorf("Expected the current log to hold 'later\\n', got %q", current)
+	}
+	if got := readGzip(t, path+".1.gz"); got != "earlier\n" {
+		t.Errorf("Expected the earlier run's log to be rotated, got %q", got)
+	}
+}
+
+func TestRotatingFileKeep(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	f, err := openRotatingFile(path, 4)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for i := 0; i < logKeep+3; i++ {
+		f.Write([]byte("line"))
+	}
+	f.Close()
+
+	for i := 1; i <= logKeep; i++ {
+		if _, err := os.Stat(rotatedName(path, i)); err != nil {
+			t.Errorf("Expected rotated log %d: %v", i, err)
+		}
+	}
+	if _, err := os.Stat(rotatedName(path, logKeep+1)); err == nil {
+		t.Errorf("Expected at most %d rotated logs", logKeep)
+	}
+}
+
+func TestRunTimeoutLogFiles(t *testing.T) {
+	tests := []struct {
+		name           string
+		tee            bool
+		combined       bool
+		expectedStdout string
+		expectedStderr string
+	}{
+		{"files only", false, false, "", ""},
+		{"tee", true, false, "out\n", "err\n"},
+		{"combined", false, true, "", ""},
+		{"combined tee", true, true, "out\n", "err\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr SafeBuffer
+			dir := t.TempDir()
+			config := Config{
+				SignalName: "TERM",
+				StdoutFile: filepath.Join(dir, "stdout.log"),
+				StderrFile: filepath.Join(dir, "stderr.log"),
+				Tee:        test.tee,
+				Stdout:     &stdout,
+				Stderr:     &stderr,
+			}
+			if test.combined {
+				config.CombinedFile = filepath.Join(dir, "combined.log")
+			}
+
+			result := runTimeout(config, []string{"5s", "sh", "-c", "echo out; sleep 0.05; echo err >&2"})
+
+			if result.ExitCode != 0 {
+				t.Errorf("Expected exit code 0, got %d (stderr: %q)", result.ExitCode, stderr.String())
+			}
+			if stdout.String() != test.expectedStdout || stderr.String() != test.expectedStderr {
+				t.Errorf("Expected pass-through %q/%q, got %q/%q", test.expectedStdout, test.expectedStderr, stdout.String(), stderr.String())
+			}
+
+			if data, _ := os.ReadFile(config.StdoutFile); string(data) != "out\n" {
+				t.Errorf("Expected stdout log 'out\\n', got %q", data)
+			}
+			if data, _ := os.ReadFile(config.StderrFile); string(data) != "err\n" {
+				t.Errorf("Expected stderr log 'err\\n', got %q", data)
+			}
+			if test.combined {
+				if data, _ := os.ReadFile(config.CombinedFile); string(data) != "out\nerr\n" {
+					t.Errorf("Expected combined log 'out\\nerr\\n', got %q", data)
+				}
+			}
+		})
+	}
+}
+
+func TestRunTimeoutLogFilePassThrough(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName: "TERM",
+		Verbose:    true,
+		StdoutFile: filepath.Join(t.TempDir(), "stdout.log"),
+		Stdout:     &stdout,
+		Stderr:     &stderr,
+	}
+
+	runTimeout(config, []string{"0.1s", "sh", "-c", "echo err >&2; exec sleep 5"})
+
+	// Only stdout has a log, so stderr still reaches the terminal, and so do
+	// timeout's own messages
+	if !strings.Contains(stderr.String(), "err\n") {
+		t.Errorf("Expected stderr to pass through, got %q", stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "timeout: sending signal TERM") {
+		t.Errorf("Expected timeout's messages on stderr, got %q", stderr.String())
+	}
+}
+
+func TestRunTimeoutParallelCombinedFile(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	path := filepath.Join(t.TempDir(), "combined.log")
+	config := Config{
+		SignalName:   "TERM",
+		Parallel:     true,
+		CombinedFile: path,
+		Stdout:       &stdout,
+		Stderr:       &stderr,
+	}
+
+	runTimeout(config, []string{"5s", "echo", "one", ":::", "echo", "two"})
+
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "[1:echo] one\n") || !strings.Contains(string(data), "[2:echo] two\n") {
+		t.Errorf("Expected both commands in the log, got %q", data)
+	}
+	if stdout.String() != "" {
+		t.Errorf("Expected no pass-through without --tee, got %q", stdout.String())
+	}
+}
+
+func TestRunTimeoutLogFilesInvalid(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{"tee without file", Config{Tee: true}},
+		{"max size without file", Config{MaxLogSize: "1M"}},
+		{"invalid size", Config{StdoutFile: filepath.Join(dir, "a.log"), MaxLogSize: "lots"}},
+		{"same file", Config{StdoutFile: filepath.Join(dir, "b.log"), StderrFile: filepath.Join(dir, "b.log")}},
+		{"stdout is combined", Config{StdoutFile: filepath.Join(dir, "d.log"), CombinedFile: filepath.Join(dir, "d.log")}},
+		{"stderr is combined", Config{StderrFile: filepath.Join(dir, "e.log"), CombinedFile: filepath.Join(dir, ".", "e.log")}},
+		{"unwritable", Config{StdoutFile: filepath.Join(dir, "missing", "c.log")}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr SafeBuffer
+			config := test.config
+			config.SignalName = "TERM"
+			config.Stdout = &stdout
+			config.Stderr = &stderr
+
+			result := runTimeout(config, []string{"5s", "true"})
+
+			if result.ExitCode != 125 {
+				t.Errorf("Expected exit code 125, got %d", result.ExitCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Formats accepted by --log-format
+const (
+	LogFormatText   = "text"
+	LogFormatJSON   = "json"
+	LogFormatLogfmt = "logfmt"
+)
+
+// openLogger builds the logger for timeout's own events from --log-format,
+// --log-level and --log-file, and returns a function closing the log file.
+// The logger is nil when the events go to stderr as text, as loggerFor then
+// writes them to each command's own stderr.
+func openLogger(config Config) (*slog.Logger, func(), error) {
+	level, err := parseLogLevel(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch config.LogFormat {
+	case "", LogFormatText, LogFormatJSON, LogFormatLogfmt:
+	default:
+		return nil, nil, fmt.Errorf("invalid log format '%s'", config.LogFormat)
+	}
+
+	if config.LogFile == "" && !structuredLog(config) {
+		return nil, func() {}, nil
+	}
+
+	w := config.Stderr
+	closeLog := func() {}
+	if config.LogFile != "" {
+		f, err := os.OpenFile(config.LogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot open log file: %v", err)
+		}
+		w = f
+		closeLog = func() { f.Close() }
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	switch config.LogFormat {
+	case LogFormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), closeLog, nil
+	case LogFormatLogfmt:
+		return slog.New(slog.NewTextHandler(w, opts)), closeLog, nil
+	}
+	return slog.New(&textHandler{w: w, level: level}), closeLog, nil
+}
+
+// loggerFor returns the logger for timeout's events about a command run
+// with config, which also sends them to --syslog
+func loggerFor(config Config) *slog.Logger {
+	logger := config.Logger
+	if logger == nil {
+		level, _ := parseLogLevel(config) // validated by openLogger
+		logger = slog.New(&textHandler{w: config.Stderr, level: level})
+	}
+	if config.syslog != nil {
+		return slog.New(teeHandler{logger.Handler(), config.syslog})
+	}
+	return logger
+}
+
+// structuredLog reports whether events are logged as JSON or logfmt
+func structuredLog(config Config) bool {
+	return config.LogFormat == LogFormatJSON || config.LogFormat == LogFormatLogfmt
+}
+
+// parseLogLevel parses --log-level. Without it, text logs show warnings
+// and errors, plus the informational events with --verbose; JSON and
+// logfmt logs always include those.
+func parseLogLevel(config Config) (slog.Level, error) {
+	switch strings.ToLower(config.LogLevel) {
+	case "":
+		if config.Verbose || structuredLog(config) {
+			return slog.LevelInfo, nil
+		}
+		return slog.LevelWarn, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("invalid log level '%s'", config.LogLevel)
+}
+
+// textHandler writes each event as the GNU-style "timeout: MESSAGE" line;
+// attributes are only kept by the structured formats
+type textHandler struct {
+	w     io.Writer
+	level slog.Level
+}
+
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	_, err := fmt.Fprintf(h.w, "timeout: %s\n", r.Message)
+	return err
+}
+
+func (h *textHandler) WithAttrs([]slog.Attr) slog.Handler {
+	return h
+}
+
+func (h *textHandler) WithGroup(string) slog.Handler {
+	return h
+}
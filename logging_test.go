@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		expected slog.Level
+		hasError bool
+	}{
+		{"default", Config{}, slog.LevelWarn, false},
+		{"default verbose", Config{Verbose: true}, slog.LevelInfo, false},
+		{"default json", Config{LogFormat: LogFormatJSON}, slog.LevelInfo, false},
+		{"default logfmt", Config{LogFormat: LogFormatLogfmt}, slog.LevelInfo, false},
+		{"debug", Config{LogLevel: "debug"}, slog.LevelDebug, false},
+		{"info", Config{LogLevel: "INFO"}, slog.LevelInfo, false},
+		{"warning", Config{LogLevel: "warning"}, slog.LevelWarn, false},
+		{"error overrides verbose", Config{LogLevel: "error", Verbose: true}, slog.LevelError, false},
+		{"invalid", Config{LogLevel: "loud"}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, err := parseLogLevel(tt.config)
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("Expected error for %q", tt.config.LogLevel)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if level != tt.expected {
+				t.Errorf("Expected level %v, got %v", tt.expected, level)
+			}
+		})
+	}
+}
+
+func TestRunTimeoutLogInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{"format", Config{LogFormat: "xml"}},
+		{"level", Config{LogLevel: "loud"}},
+		{"file", Config{LogFile: filepath.Join(t.TempDir(), "missing", "timeout.log")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr SafeBuffer
+			tt.config.SignalName = "TERM"
+			tt.config.Stdout = &stdout
+			tt.config.Stderr = &stderr
+
+			result := runTimeout(tt.config, []string{"5s", "true"})
+
+			if result.ExitCode != 125 {
+				t.Errorf("Expected exit code 125, got %d", result.ExitCode)
+			}
+			if !strings.HasPrefix(stderr.String(), "timeout: ") {
+				t.Errorf("Expected an error message, got %q", stderr.String())
+			}
+		})
+	}
+}
+
+func TestRunTimeoutLogJSON(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", KillAfter: "5s", LogFormat: LogFormatJSON, LogLevel: "debug", Stdout: &stdout, Stderr: &stderr}
+	clock := newFakeClock()
+	proc := newFakeProcess(exitOn(-1, syscall.SIGKILL))
+
+	results := runFake(config, clock, proc, []string{"10s", "server"})
+	clock.WaitForTimers(t, 1)
+	clock.Advance(10 * time.Second)
+	clock.WaitForTimers(t, 1)
+	clock.Advance(5 * time.Second)
+	waitResult(t, results)
+
+	var events []string
+	byEvent := map[string]map[string]any{}
+	for _, line := range strings.Split(strings.TrimSpace(stderr.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Expected a JSON log line, got %q: %v", line, err)
+		}
+		event, _ := record["event"].(string)
+		events = append(events, event)
+		byEvent[event] = record
+	}
+
+	expected := "start,deadline,signal,kill-after,exit,end"
+	if strings.Join(events, ",") != expected {
+		t.Errorf("Expected events %s, got %s", expected, strings.Join(events, ","))
+	}
+	if signal := byEvent["signal"]; signal["signal"] != "TERM" || signal["pid"] != float64(4242) || signal["level"] != "INFO" {
+		t.Errorf("Unexpected signal event: %v", signal)
+	}
+	if end := byEvent["end"]; end["reason"] != ReasonTimeout || end["exit_code"] != float64(124) {
+		t.Errorf("Unexpected end event: %v", end)
+	}
+}
+
+func TestRunTimeoutLogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timeout.log")
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", LogFormat: LogFormatLogfmt, LogFile: path, Stdout: &stdout, Stderr: &stderr}
+	clock := newFakeClock()
+	proc := newFakeProcess(exitOn(-1, syscall.SIGTERM))
+
+	results := runFake(config, clock, proc, []string{"1s", "server"})
+	clock.WaitForTimers(t, 1)
+	clock.Advance(time.Second)
+	waitResult(t, results)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := string(data)
+	if !strings.Contains(log, "level=INFO") || !strings.Contains(log, "event=signal") || !strings.Contains(log, "signal=TERM") {
+		t.Errorf("Expected a logfmt signal event, got %q", log)
+	}
+	if strings.Contains(log, "event=start") {
+		t.Errorf("Debug events should not be logged at the default level, got %q", log)
+	}
+	if stderr.String() != "" {
+		t.Errorf("Expected nothing on stderr, got %q", stderr.String())
+	}
+}
+
+func TestRunTimeoutLogText(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", LogLevel: "debug", Stdout: &stdout, Stderr: &stderr}
+	clock := newFakeClock()
+	proc := newFakeProcess(exitOn(-1, syscall.SIGTERM))
+
+	results := runFake(config, clock, proc, []string{"1s", "server"})
+	clock.WaitForTimers(t, 1)
+	clock.Advance(time.Second)
+	waitResult(t, results)
+
+	for _, line := range []string{
+		"timeout: started command 'server' with pid 4242\n",
+		"timeout: command 'server' times out in 1s\n",
+		"timeout: sending signal TERM to command 'server'\n",
+		"timeout: command 'server' exited with status -1\n",
+	} {
+		if !strings.Contains(stderr.String(), line) {
+			t.Errorf("Expected %q in the log, got %q", line, stderr.String())
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// metricLabelName matches a valid Prometheus label name
+var metricLabelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// metricLabel is a name="value" pair added to every metric
+type metricLabel struct {
+	name  string
+	value string
+}
+
+// parseMetricLabels parses the --metrics-label NAME=VALUE options
+func parseMetricLabels(config Config) ([]metricLabel, error) {
+	if config.MetricsFile == "" && config.StatsD == "" {
+		if len(config.MetricsLabels) > 0 {
+			return nil, fmt.Errorf("--metrics-label requires --metrics-file or --statsd")
+		}
+		return nil, nil
+	}
+
+	var labels []metricLabel
+	seen := map[string]bool{}
+	for _, label := range config.MetricsLabels {
+		name, value, ok := strings.Cut(label, "=")
+		if !ok || !metricLabelName.MatchString(name) || strings.HasPrefix(name, "__") {
+			return nil, fmt.Errorf("invalid metrics label '%s'", label)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate metrics label '%s'", name)
+		}
+		seen[name] = true
+		labels = append(labels, metricLabel{name, value})
+	}
+	return labels, nil
+}
+
+// ranOutOfTime reports whether reason means the command ran out of time
+func ranOutOfTime(reason string) bool {
+	return reason == ReasonTimeout || reason == ReasonDeadline || reason == ReasonBudget
+}
+
+// formatMetrics renders result in the Prometheus text exposition format
+func formatMetrics(result Result, labels []metricLabel) string {
+	var set string
+	if len(labels) > 0 {
+		pairs := make([]string, len(labels))
+		for i, l := range labels {
+			pairs[i] = fmt.Sprintf(`%s="%s"`, l.name, labelEscaper.Replace(l.value))
+		}
+		set = "{" + strings.Join(pairs, ",") + "}"
+	}
+
+	expired := 0.0
+	if ranOutOfTime(result.Reason) {
+		expired = 1
+	}
+
+	var b strings.Builder
+	metric := func(name, kind, help string, value float64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, kind)
+		fmt.Fprintf(&b, "%s%s %s\n", name, set, strconv.FormatFloat(value, 'g', -1, 64))
+	}
+	metric("timeout_duration_seconds", "gauge", "How long the command ran.", result.Elapsed.Seconds())
+	metric("timeout_limit_seconds", "gauge", "Time the command was allowed, 0 for no limit.", result.Limit.Seconds())
+	metric("timeout_timed_out", "gauge", "Whether the command ran out of time.", expired)
+	metric("timeout_exit_code", "gauge", "Exit status of timeout.", float64(result.ExitCode))
+	metric("timeout_signals_sent_total", "counter", "Signals sent to the command.", float64(len(result.Signals)))
+	return b.String()
+}
+
+// labelEscaper escapes a label value for the exposition format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeMetrics writes the metrics for result to path, through a temporary
+// file renamed into place so a collector never reads a partial file
+func writeMetrics(path string, result Result, labels []metricLabel) error {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+base+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("cannot write metrics: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(formatMetrics(result, labels)); err != nil {
+		tmp.Close()
+		return fmt.Errorf("cannot write metrics: %v", err)
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("cannot write metrics: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("cannot write metrics: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("cannot write metrics: %v", err)
+	}
+	return nil
+}
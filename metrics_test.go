@@ -0,0 +1,169 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseMetricLabels(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		expected []metricLabel
+		hasError bool
+	}{
+		{"none", Config{MetricsFile: "job.prom"}, nil, false},
+		{"labels", Config{MetricsFile: "job.prom", MetricsLabels: []string{"job=backup", "host=db-1"}}, []metricLabel{{"job", "backup"}, {"host", "db-1"}}, false},
+		{"empty value", Config{MetricsFile: "job.prom", MetricsLabels: []string{"job="}}, []metricLabel{{"job", ""}}, false},
+		{"value with equals", Config{MetricsFile: "job.prom", MetricsLabels: []string{"args=a=b"}}, []metricLabel{{"args", "a=b"}}, false},
+		{"missing equals", Config{MetricsFile: "job.prom", MetricsLabels: []string{"job"}}, nil, true},
+		{"invalid name", Config{MetricsFile: "job.prom", MetricsLabels: []string{"1job=x"}}, nil, true},
+		{"reserved name", Config{MetricsFile: "job.prom", MetricsLabels: []string{"__name__=x"}}, nil, true},
+		{"duplicate", Config{MetricsFile: "job.prom", MetricsLabels: []string{"job=a", "job=b"}}, nil, true},
+		{"without file", Config{MetricsLabels: []string{"job=backup"}}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels, err := parseMetricLabels(tt.config)
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("Expected error for %v", tt.config.MetricsLabels)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(labels) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, labels)
+			}
+			for i := range labels {
+				if labels[i] != tt.expected[i] {
+					t.Errorf("Expected %v, got %v", tt.expected[i], labels[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFormatMetrics(t *testing.T) {
+	result := Result{
+		ExitCode: 124,
+		Reason:   ReasonTimeout,
+		Elapsed:  1500 * time.Millisecond,
+		Limit:    time.Second,
+		Signals:  []string{"TERM", "KILL"},
+	}
+	labels := []metricLabel{{"job", "backup"}, {"note", "say \"hi\"\\\n"}}
+
+	expected := `# HELP timeout_duration_seconds How long the command ran.
+# TYPE timeout_duration_seconds gauge
+timeout_duration_seconds{job="backup",note="say \"hi\"\\\n"} 1.5
+# HELP timeout_limit_seconds Time the command was allowed, 0 for no limit.
+# TYPE timeout_limit_seconds gauge
+timeout_limit_seconds{job="backup",note="say \"hi\"\\\n"} 1
+# HELP timeout_timed_out Whether the command ran out of time.
+# TYPE timeout_timed_out gauge
+timeout_timed_out{job="backup",note="say \"hi\"\\\n"} 1
+# HELP timeout_exit_code Exit status of timeout.
+# TYPE timeout_exit_code gauge
+timeout_exit_code{job="backup",note="say \"hi\"\\\n"} 124
+# HELP timeout_signals_sent_total Signals sent to the command.
+# TYPE timeout_signals_sent_total counter
+timeout_signals_sent_total{job="backup",note="say \"hi\"\\\n"} 2
+`
+	if got := formatMetrics(result, labels); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	plain := formatMetrics(Result{Reason: ReasonCompleted}, nil)
+	if !strings.Contains(plain, "\ntimeout_timed_out 0\n") || !strings.Contains(plain, "\ntimeout_limit_seconds 0\n") {
+		t.Errorf("Expected unlabelled metrics for a completed run, got:\n%s", plain)
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "job.prom")
+	if err := os.WriteFile(path, []byte("stale\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeMetrics(path, Result{Reason: ReasonCompleted}, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "# HELP timeout_duration_seconds") {
+		t.Errorf("Expected the metrics to replace the old file, got %q", string(data))
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("Expected mode 0644 for the collector, got %v", info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected no temporary files to be left, got %d entries", len(entries))
+	}
+
+	if err := writeMetrics(filepath.Join(dir, "missing", "job.prom"), Result{}, nil); err == nil {
+		t.Errorf("Expected an error for a missing directory")
+	}
+}
+
+func TestRunTimeoutMetrics(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "job.prom")
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", MetricsFile: path, MetricsLabels: []string{"job=nightly"}, Stdout: &stdout, Stderr: &stderr}
+	clock := newFakeClock()
+	proc := newFakeProcess(exitOn(-1, syscall.SIGTERM))
+
+	results := runFake(config, clock, proc, []string{"10s", "server"})
+	clock.WaitForTimers(t, 1)
+	clock.Advance(10 * time.Second)
+	result := waitResult(t, results)
+
+	if result.Limit != 10*time.Second {
+		t.Errorf("Expected the result to carry the 10s limit, got %v", result.Limit)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected a metrics file: %v", err)
+	}
+	for _, line := range []string{
+		`timeout_duration_seconds{job="nightly"} 10`,
+		`timeout_limit_seconds{job="nightly"} 10`,
+		`timeout_timed_out{job="nightly"} 1`,
+		`timeout_exit_code{job="nightly"} 124`,
+		`timeout_signals_sent_total{job="nightly"} 1`,
+	} {
+		if !strings.Contains(string(data), line+"\n") {
+			t.Errorf("Expected %q in the metrics, got:\n%s", line, string(data))
+		}
+	}
+}
+
+func TestRunTimeoutMetricsInvalid(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", MetricsLabels: []string{"job=nightly"}, Stdout: &stdout, Stderr: &stderr}
+
+	result := runTimeout(config, []string{"5s", "true"})
+
+	if result.ExitCode != 125 {
+		t.Errorf("Expected exit code 125, got %d", result.ExitCode)
+	}
+	if !strings.Contains(stderr.String(), "--metrics-label requires --metrics-file or --statsd") {
+		t.Errorf("Expected an error message, got %q", stderr.String())
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// notifyTailLines is how many trailing lines of each output stream a
+// notification carries
+const notifyTailLines = 20
+
+// Notifications are retried after notifyBackoff, doubling each time, for
+// at most notifyAttempts attempts within notifyLimit
+const (
+	notifyAttempts = 3
+	notifyBackoff  = 500 * time.Millisecond
+	notifyLimit    = 10 * time.Second
+)
+
+// notifier posts a notification to --notify-url when a command times out
+type notifier struct {
+	url      string
+	template *template.Template
+}
+
+// notification is the JSON payload posted by --notify-url, and the data of
+// a --notify-template
+type notification struct {
+	Host     string   `json:"host"`
+	Command  []string `json:"command"`
+	Duration float64  `json:"duration_seconds"`
+	Reason   string   `json:"reason"`
+	ExitCode int      `json:"exit_code"`
+	Signals  []string `json:"signals_sent,omitempty"`
+	Stdout   []string `json:"stdout_tail"`
+	Stderr   []string `json:"stderr_tail"`
+}
+
+// notifyFuncs are the functions available to --notify-template
+var notifyFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"join": strings.Join,
+}
+
+// parseNotifier builds the notifier for --notify-url and --notify-template.
+// It returns nil when --notify-url is not set.
+func parseNotifier(config Config) (*notifier, error) {
+	if config.NotifyURL == "" {
+		if config.NotifyTemplate != "" {
+			return nil, fmt.Errorf("--notify-template requires --notify-url")
+		}
+		return nil, nil
+	}
+	if u, err := url.Parse(config.NotifyURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid notify URL '%s'", config.NotifyURL)
+	}
+
+	n := &notifier{url: config.NotifyURL}
+	if config.NotifyTemplate != "" {
+		text, err := os.ReadFile(config.NotifyTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read notify template: %v", err)
+		}
+		n.template, err = template.New("notify").Funcs(notifyFuncs).Parse(string(text))
+		if err != nil {
+			return nil, fmt.Errorf("invalid notify template: %v", err)
+		}
+	}
+	return n, nil
+}
+
+// newNotification describes the run of command that produced result
+func newNotification(command []string, result Result) notification {
+	host, _ := os.Hostname()
+	return notification{
+		Host:     host,
+		Command:  command,
+		Duration: result.Elapsed.Seconds(),
+		Reason:   result.Reason,
+		ExitCode: result.ExitCode,
+		Signals:  result.Signals,
+		Stdout:   nonNil(result.StdoutTail),
+		Stderr:   nonNil(result.StderrTail),
+	}
+}
+
+// nonNil returns lines, or an empty slice so it encodes as [] not null
+func nonNil(lines []string) []string {
+	if lines == nil {
+		return []string{}
+	}
+	return lines
+}
+
+// notify posts the notification for result, retrying failed attempts
+func (n *notifier) notify(command []string, result Result) error {
+	var body bytes.Buffer
+	data := newNotification(command, result)
+	if n.template != nil {
+		if err := n.template.Execute(&body, data); err != nil {
+			return fmt.Errorf("cannot send notification: %v", err)
+		}
+	} else if err := json.NewEncoder(&body).Encode(data); err != nil {
+		return fmt.Errorf("cannot send notification: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyLimit)
+	defer cancel()
+
+	backoff := notifyBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		retry, err = n.post(ctx, body.Bytes())
+		if err == nil || !retry || attempt == notifyAttempts {
+			break
+		}
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return fmt.Errorf("cannot send notification: %v", err)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("cannot send notification: %v", err)
+	}
+	return nil
+}
+
+// post makes one attempt at posting body, reporting whether a failure is
+// worth retrying
+func (n *notifier) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "timeout/"+Version)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("server returned %s", resp.Status)
+	}
+	return false, nil
+}
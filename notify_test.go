@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// webhook is a stand-in notification endpoint answering with statuses in
+// turn, repeating the last one
+type webhook struct {
+	server   *httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	bodies   []string
+}
+
+func newWebhook(t *testing.T, statuses ...int) *webhook {
+	w := &webhook{statuses: statuses}
+	w.server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Expected a JSON POST, got %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+
+		w.mu.Lock()
+		w.bodies = append(w.bodies, string(data))
+		status := w.statuses[min(len(w.bodies), len(w.statuses))-1]
+		w.mu.Unlock()
+		rw.WriteHeader(status)
+	}))
+	t.Cleanup(w.server.Close)
+	return w
+}
+
+func (w *webhook) received() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string{}, w.bodies...)
+}
+
+func TestParseNotifier(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.tmpl")
+	invalid := filepath.Join(dir, "invalid.tmpl")
+	os.WriteFile(valid, []byte(`{"text": {{.Reason | json}}}`), 0644)
+	os.WriteFile(invalid, []byte(`{{.Reason`), 0644)
+
+	tests := []struct {
+		name     string
+		config   Config
+		hasError bool
+	}{
+		{"none", Config{}, false},
+		{"url", Config{NotifyURL: "https://hooks.example.com/x"}, false},
+		{"template", Config{NotifyURL: "http://localhost:8080/", NotifyTemplate: valid}, false},
+		{"template without url", Config{NotifyTemplate: valid}, true},
+		{"relative url", Config{NotifyURL: "hooks.example.com/x"}, true},
+		{"unsupported scheme", Config{NotifyURL: "ftp://hooks.example.com/x"}, true},
+		{"missing template", Config{NotifyURL: "http://localhost/", NotifyTemplate: filepath.Join(dir, "missing")}, true},
+		{"invalid template", Config{NotifyURL: "http://localhost/", NotifyTemplate: invalid}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseNotifier(tt.config)
+			if tt.hasError && err == nil {
+				t.Errorf("Expected error for %+v", tt.config)
+			}
+			if !tt.hasError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestRunTimeoutNotify(t *testing.T) {
+	hook := newWebhook(t, http.StatusOK)
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", NotifyURL: hook.server.URL, Stdout: &stdout, Stderr: &stderr}
+
+	result := runTimeout(config, []string{"0.5s", "sh", "-c", "echo started; echo oops >&2; exec sleep 10"})
+
+	if result.ExitCode != 124 {
+		t.Errorf("Expected exit code 124, got %d", result.ExitCode)
+	}
+	bodies := hook.received()
+	if len(bodies) != 1 {
+		t.Fatalf("Expected one notification, got %d", len(bodies))
+	}
+
+	var got notification
+	if err := json.Unmarshal([]byte(bodies[0]), &got); err != nil {
+		t.Fatalf("Notification is not valid JSON: %v", err)
+	}
+	host, _ := os.Hostname()
+	if got.Host != host || got.Reason != ReasonTimeout || got.ExitCode != 124 {
+		t.Errorf("Unexpected notification: %+v", got)
+	}
+	if strings.Join(got.Command, " ") != "sh -c echo started; echo oops >&2; exec sleep 10" {
+		t.Errorf("Expected the command line, got %v", got.Command)
+	}
+	if got.Duration < 0.5 {
+		t.Errorf("Expected a duration of at least 0.5s, got %v", got.Duration)
+	}
+	if strings.Join(got.Stdout, "|") != "started" || strings.Join(got.Stderr, "|") != "oops" {
+		t.Errorf("Expected the output tails, got %v and %v", got.Stdout, got.Stderr)
+	}
+}
+
+func TestRunTimeoutNotifyCompleted(t *testing.T) {
+	hook := newWebhook(t, http.StatusOK)
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", NotifyURL: hook.server.URL, Stdout: &stdout, Stderr: &stderr}
+
+	result := runTimeout(config, []string{"5s", "sh", "-c", "exit 2"})
+
+	if result.ExitCode != 2 {
+		t.Errorf("Expected exit code 2, got %d", result.ExitCode)
+	}
+	if bodies := hook.received(); len(bodies) != 0 {
+		t.Errorf("Expected no notification for a command that was not stopped, got %v", bodies)
+	}
+}
+
+func TestRunTimeoutNotifyRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		requests int
+		message  string
+	}{
+		{"recovers", []int{http.StatusServiceUnavailable, http.StatusOK}, 2, ""},
+		{"gives up", []int{http.StatusBadGateway}, notifyAttempts, "timeout: cannot send notification: server returned 502"},
+		{"client error", []int{http.StatusBadRequest}, 1, "timeout: cannot send notification: server returned 400"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := newWebhook(t, tt.statuses...)
+			var stdout, stderr SafeBuffer
+			config := Config{SignalName: "TERM", NotifyURL: hook.server.URL, Stdout: &stdout, Stderr: &stderr}
+			clock := newFakeClock()
+			proc := newFakeProcess(exitOn(-1, syscall.SIGTERM))
+
+			results := runFake(config, clock, proc, []string{"1s", "cron-job"})
+			clock.WaitForTimers(t, 1)
+			clock.Advance(time.Second)
+			result := waitResult(t, results)
+
+			if result.ExitCode != 124 {
+				t.Errorf("A notification should never change the exit code, got %d", result.ExitCode)
+			}
+			if n := len(hook.received()); n != tt.requests {
+				t.Errorf("Expected %d requests, got %d", tt.requests, n)
+			}
+			if tt.message == "" && stderr.String() != "" {
+				t.Errorf("Expected no error, got %q", stderr.String())
+			}
+			if tt.message != "" && !strings.Contains(stderr.String(), tt.message) {
+				t.Errorf("Expected %q, got %q", tt.message, stderr.String())
+			}
+		})
+	}
+}
+
+func TestRunTimeoutNotifyTemplate(t *testing.T) {
+	hook := newWebhook(t, http.StatusOK)
+	tmpl := filepath.Join(t.TempDir(), "slack.tmpl")
+	text := `{"text": {{printf "%s stopped (%s) with status %d" (join .Command " ") .Reason .ExitCode | json}}}`
+	if err := os.WriteFile(tmpl, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", NotifyURL: hook.server.URL, NotifyTemplate: tmpl, Stdout: &stdout, Stderr: &stderr}
+	clock := newFakeClock()
+	proc := newFakeProcess(exitOn(-1, syscall.SIGTERM))
+
+	results := runFake(config, clock, proc, []string{"1s", "backup", "--full"})
+	clock.WaitForTimers(t, 1)
+	clock.Advance(time.Second)
+	waitResult(t, results)
+
+	expected := `{"text": "backup --full stopped (timeout) with status 124"}`
+	if bodies := hook.received(); len(bodies) != 1 || bodies[0] != expected {
+		t.Errorf("Expected %s, got %v", expected, bodies)
+	}
+}
+
+func TestRunTimeoutNotifyInvalid(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", NotifyURL: "not a url", Stdout: &stdout, Stderr: &stderr}
+
+	result := runTimeout(config, []string{"5s", "true"})
+
+	if result.ExitCode != 125 {
+		t.Errorf("Expected exit code 125, got %d", result.ExitCode)
+	}
+	if !strings.Contains(stderr.String(), "invalid notify URL") {
+		t.Errorf("Expected an error message, got %q", stderr.String())
+	}
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxLineLength bounds how much of an unterminated line lineWriter buffers
+const maxLineLength = 64 * 1024
+
+// lineWriter calls fn for every complete line written to it. A trailing
+// partial line is held back until it is terminated or Flush is called.
+type lineWriter struct {
+	mu  sync.Mutex
+	buf []byte
+	fn  func(line []byte)
+}
+
+func newLineWriter(fn func(line []byte)) *lineWriter {
+	return &lineWriter{fn: fn}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.fn(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	if len(w.buf) >= maxLineLength {
+		w.fn(w.buf)
+		w.buf = nil
+	}
+	return len(p), nil
+}
+
+// Flush delivers any buffered partial line
+func (w *lineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) > 0 {
+		w.fn(w.buf)
+		w.buf = nil
+	}
+}
+
+// Insert delivers any buffered partial line, then line
+func (w *lineWriter) Insert(line []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) > 0 {
+		w.fn(w.buf)
+		w.buf = nil
+	}
+	w.fn(line)
+}
+
+// tee returns w, or a writer duplicating every write to w and the taps when
+// any are given. A nil w discards the command's output as os/exec would.
+func tee(w io.Writer, taps ...io.Writer) io.Writer {
+	if len(taps) == 0 {
+		return w
+	}
+	if w == nil {
+		w = io.Discard
+	}
+	return io.MultiWriter(append([]io.Writer{w}, taps...)...)
+}
+
+// outputTriggers watches the command's output for --kill-on-output patterns
+type outputTriggers struct {
+	stdout *lineWriter
+	stderr *lineWriter
+
+	// matched receives the first line that matched a pattern
+	matched chan string
+}
+
+// parseOutputTriggers compiles --kill-on-output patterns. A pattern may be
+// prefixed with "stdout:" or "stderr:" to watch only that stream; otherwise
+// both are watched. It returns nil when there are no patterns.
+func parseOutputTriggers(patterns []string) (*outputTriggers, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	var stdoutRes, stderrRes []*regexp.Regexp
+	for _, pattern := range patterns {
+		stdout, stderr := true, true
+		expr := pattern
+		if rest, ok := strings.CutPrefix(pattern, "stdout:"); ok {
+			stderr, expr = false, rest
+		} else if rest, ok := strings.CutPrefix(pattern, "stderr:"); ok {
+			stdout, expr = false, rest
+		}
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid output pattern '%s': %v", pattern, err)
+		}
+		if stdout {
+			stdoutRes = append(stdoutRes, re)
+		}
+		if stderr {
+			stderrRes = append(stderrRes, re)
+		}
+	}
+
+	t := &outputTriggers{matched: make(chan string, 1)}
+	t.stdout = newLineWriter(t.watch(stdoutRes))
+	t.stderr = newLineWriter(t.watch(stderrRes))
+	return t, nil
+}
+
+// watch returns a line callback reporting the first line matching any of res
+func (t *outputTriggers) watch(res []*regexp.Regexp) func(line []byte) {
+	return func(line []byte) {
+		for _, re := range res {
+			if re.Match(line) {
+				select {
+				case t.matched <- string(line):
+				default:
+					// Already triggered
+				}
+				return
+			}
+		}
+	}
+}
+
+// outputTail keeps the last lines of each of the command's output streams
+// for --tail-on-timeout
+type outputTail struct {
+	stdout *lineWriter
+	stderr *lineWriter
+
+	stdoutLines *lineRing
+	stderrLines *lineRing
+}
+
+func newOutputTail(n int) *outputTail {
+	t := &outputTail{
+		stdoutLines: &lineRing{lines: make([]string, n)},
+		stderrLines: &lineRing{lines: make([]string, n)},
+	}
+	t.stdout = newLineWriter(t.stdoutLines.add)
+	t.stderr = newLineWriter(t.stderrLines.add)
+	return t
+}
+
+// print writes a delimited summary of the run and the retained lines to w
+func (t *outputTail) print(w io.Writer, command, reason string, elapsed time.Duration, signals []string) {
+	t.stdout.Flush()
+	t.stderr.Flush()
+
+	sent := "none"
+	if len(signals) > 0 {
+		sent = strings.Join(signals, ", ")
+	}
+
+	fmt.Fprintf(w, "==== timeout: command '%s' stopped (%s) after %s; signals sent: %s ====\n",
+		command, reason, elapsed.Round(time.Millisecond), sent)
+	t.stdoutLines.print(w, "stdout")
+	t.stderrLines.print(w, "stderr")
+	fmt.Fprintf(w, "==== end of timeout summary ====\n")
+}
+
+// lineRing is a fixed-size ring buffer of lines
+type lineRing struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+	count int
+}
+
+func (r *lineRing) add(line []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lines[r.next] = string(line)
+	r.next = (r.next + 1) % len(r.lines)
+	if r.count < len(r.lines) {
+		r.count++
+	}
+}
+
+// snapshot returns the retained lines, oldest first
+func (r *lineRing) snapshot() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lines := make([]string, 0, r.count)
+	start := (r.next - r.count + len(r.lines)) % len(r.lines)
+	for i := 0; i < r.count; i++ {
+		lines = append(lines, r.lines[(start+i)%len(r.lines)])
+	}
+	return lines
+}
+
+func (r *lineRing) print(w io.Writer, stream string) {
+	lines := r.snapshot()
+	fmt.Fprintf(w, "---- last %d lines of %s ----\n", len(lines), stream)
+	for _, line := range lines {
+		fmt.Fprintf(w, "%s\n", line)
+	}
+}
+
+// Timestamp formats accepted by --timestamps
+const (
+	TimestampsRFC3339 = "rfc3339"
+	TimestampsElapsed = "elapsed"
+)
+
+// stampLayout is the RFC 3339 layout used by --timestamps, with milliseconds
+const stampLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// stampedOutput writes each line of the command's output with a timestamp
+// and prefix in front of it, for --timestamps and --prefix
+type stampedOutput struct {
+	clock  Clock
+	start  time.Time
+	format string
+	prefix string
+
+	stdout *lineWriter
+	stderr *lineWriter
+}
+
+// newStampedOutput returns the settings for --timestamps and --prefix, or
+// nil when neither is set
+func newStampedOutput(config Config) (*stampedOutput, error) {
+	switch config.Timestamps {
+	case "", TimestampsRFC3339, TimestampsElapsed:
+	default:
+		return nil, fmt.Errorf("invalid timestamp format '%s'", config.Timestamps)
+	}
+	if config.Timestamps == "" && config.Prefix == "" {
+		return nil, nil
+	}
+
+	o := &stampedOutput{
+		clock:  config.Clock,
+		format: config.Timestamps,
+		prefix: config.Prefix,
+	}
+	return o, nil
+}
+
+// wrap returns the writers stamping the lines of the command's output
+// before passing them to stdout and stderr. Elapsed times count from now.
+func (o *stampedOutput) wrap(stdout, stderr io.Writer) (io.Writer, io.Writer) {
+	o.start = o.clock.Now()
+	o.stdout = newLineWriter(o.writeTo(stdout))
+	o.stderr = newLineWriter(o.writeTo(stderr))
+	return o.stdout, o.stderr
+}
+
+// writeTo returns a line callback writing stamped lines to w
+func (o *stampedOutput) writeTo(w io.Writer) func(line []byte) {
+	if w == nil {
+		w = io.Discard
+	}
+	return func(line []byte) {
+		fmt.Fprintf(w, "%s%s%s\n", o.stamp(), o.prefix, line)
+	}
+}
+
+// stamp returns the timestamp for a line written now
+func (o *stampedOutput) stamp() string {
+	switch o.format {
+	case TimestampsRFC3339:
+		return o.clock.Now().Format(stampLayout) + " "
+	case TimestampsElapsed:
+		return fmt.Sprintf("%9.3fs ", o.clock.Now().Sub(o.start).Seconds())
+	}
+	return ""
+}
+
+// mark records an event such as a signal being sent in both streams
+func (o *stampedOutput) mark(event string) {
+	line := []byte("*** timeout: " + event + " ***")
+	o.stdout.Insert(line)
+	o.stderr.Insert(line)
+}
+
+// Flush delivers the partial lines left when the command exits
+func (o *stampedOutput) Flush() {
+	o.stdout.Flush()
+	o.stderr.Flush()
+}
+
+// Actions taken once --max-output is exceeded
+const (
+	OutputLimitKill     = "kill"
+	OutputLimitTruncate = "truncate"
+)
+
+// outputLimit caps the number of bytes the command may write to stdout and
+// stderr together, for --max-output
+type outputLimit struct {
+	mu       sync.Mutex
+	max      int64
+	written  int64
+	truncate bool
+
+	// exceeded is closed once the command writes more than max bytes
+	exceeded chan struct{}
+
+	// truncated is called once when output is first dropped
+	truncated func()
+}
+
+// parseOutputLimit parses --max-output and --max-output-action. It returns
+// nil when there is no limit.
+func parseOutputLimit(config Config) (*outputLimit, error) {
+	switch config.MaxOutputAction {
+	case "", OutputLimitKill, OutputLimitTruncate:
+	default:
+		return nil, fmt.Errorf("invalid output limit action '%s'", config.MaxOutputAction)
+	}
+	if config.MaxOutput == "" {
+		if config.MaxOutputAction != "" {
+			return nil, fmt.Errorf("--max-output-action requires --max-output")
+		}
+		return nil, nil
+	}
+
+	max, err := parseSize(config.MaxOutput)
+	if err != nil {
+		return nil, err
+	}
+	if max == 0 {
+		return nil, nil
+	}
+	return &outputLimit{
+		max:      max,
+		truncate: config.MaxOutputAction == OutputLimitTruncate,
+		exceeded: make(chan struct{}),
+	}, nil
+}
+
+// wrap returns a writer passing output on to w until the limit is reached
+func (l *outputLimit) wrap(w io.Writer) io.Writer {
+	if w == nil {
+		w = io.Discard
+	}
+	return &limitedWriter{limit: l, w: w}
+}
+
+// allow counts n more bytes and returns how many of them may be written
+func (l *outputLimit) allow(n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	remaining := l.max - l.written
+	if int64(n) <= remaining {
+		l.written += int64(n)
+		return n
+	}
+	if l.written <= l.max {
+		close(l.exceeded)
+		if l.truncated != nil {
+			l.truncated()
+		}
+	}
+	l.written = l.max + 1
+	if remaining < 0 {
+		remaining = 0
+	}
+	return int(remaining)
+}
+
+// limitedWriter is one of the command's output streams under an outputLimit.
+// Output past the limit is dropped without failing the command's writes.
+type limitedWriter struct {
+	limit *outputLimit
+	w     io.Writer
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	n := w.limit.allow(len(p))
+	if n > 0 {
+		if _, err := w.w.Write(p[:n]); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestLineWriter(t *testing.T) {
+	var lines []string
+	w := newLineWriter(func(line []byte) {
+		lines = append(lines, string(line))
+	})
+
+	w.Write([]byte("one\ntw"))
+	w.Write([]byte("o\nthree"))
+	if expected := []string{"one", "two"}; !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected %q before flush, got %q", expected, lines)
+	}
+
+	w.Flush()
+	if expected := []string{"one", "two", "three"}; !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected %q after flush, got %q", expected, lines)
+	}
+}
+
+func TestLineWriterLongLine(t *testing.T) {
+	var lines []string
+	w := newLineWriter(func(line []byte) {
+		lines = append(lines, string(line))
+	})
+
+	w.Write([]byte(strings.Repeat("x", maxLineLength+1)))
+	if len(lines) != 1 || len(lines[0]) != maxLineLength+1 {
+		t.Errorf("Expected an overlong partial line to be delivered, got %d lines", len(lines))
+	}
+}
+
+func TestParseOutputTriggers(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		stdout   string
+		stderr   string
+		matched  string
+		hasError bool
+	}{
+		{"none", nil, "", "", "", false},
+		{"both streams", []string{"panic:"}, "", "panic: oops", "panic: oops", false},
+		{"stdout only", []string{"stdout:deadlock"}, "", "deadlock detected", "", false},
+		{"stdout only match", []string{"stdout:deadlock"}, "deadlock detected", "", "deadlock detected", false},
+		{"stderr only", []string{"stderr:^fatal"}, "fatal error", "", "", false},
+		{"stderr only match", []string{"stderr:^fatal"}, "", "fatal error", "fatal error", false},
+		{"invalid", []string{"stderr:("}, "", "", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			triggers, err := parseOutputTriggers(test.patterns)
+
+			if test.hasError {
+				if err == nil {
+					t.Errorf("Expected error, but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+
+			if len(test.patterns) == 0 {
+				if triggers != nil {
+					t.Errorf("Expected no triggers without patterns")
+				}
+				return
+			}
+
+			triggers.stdout.Write([]byte(test.stdout + "\n"))
+			triggers.stderr.Write([]byte(test.stderr + "\n"))
+
+			var matched string
+			select {
+			case matched = <-triggers.matched:
+			default:
+			}
+			if matched != test.matched {
+				t.Errorf("Expected match %q, got %q", test.matched, matched)
+			}
+		})
+	}
+}
+
+func TestTee(t *testing.T) {
+	var out, tap SafeBuffer
+	if w := tee(&out); w != &out {
+		t.Errorf("Expected tee without taps to return the writer unchanged")
+	}
+
+	tee(&out, &tap).Write([]byte("hello"))
+	if out.String() != "hello" || tap.String() != "hello" {
+		t.Errorf("Expected both writers to receive output, got %q and %q", out.String(), tap.String())
+	}
+
+	if _, err := tee(nil, &tap).Write([]byte("x")); err != nil {
+		t.Errorf("Unexpected error writing with nil writer: %v", err)
+	}
+}
+
+func TestRunTimeoutKillOnOutput(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName:   "TERM",
+		KillOnOutput: []string{"stderr:deadlock detected"},
+		Stdout:       &stdout,
+		Stderr:       &stderr,
+	}
+
+	start := time.Now()
+	result := runTimeout(config, []string{"10s", "sh", "-c", "echo working; echo 'fatal: deadlock detected' >&2; exec sleep 5"})
+
+	if result.ExitCode != 124 {
+		t.Errorf("Expected exit code 124 on output match, got %d", result.ExitCode)
+	}
+	if result.Reason != ReasonOutput {
+		t.Errorf("Expected reason %q, got %q", ReasonOutput, result.Reason)
+	}
+	if result.Matched != "fatal: deadlock detected" {
+		t.Errorf("Expected matched line to be recorded, got %q", result.Matched)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Output match should stop the command immediately, took %v", elapsed)
+	}
+	if !strings.Contains(stderr.String(), "deadlock detected") {
+		t.Errorf("Command stderr should pass through, got %q", stderr.String())
+	}
+}
+
+func TestRunTimeoutKillOnOutputNoMatch(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName:   "TERM",
+		KillOnOutput: []string{"stdout:panic:"},
+		Stdout:       &stdout,
+		Stderr:       &stderr,
+	}
+
+	result := runTimeout(config, []string{"5s", "sh", "-c", "echo 'panic: on stderr' >&2"})
+
+	if result.ExitCode != 0 {
+		t.Errorf("Expected exit code 0 without a stdout match, got %d", result.ExitCode)
+	}
+	if result.Matched != "" {
+		t.Errorf("Expected no matched line, got %q", result.Matched)
+	}
+}
+
+func TestLineRing(t *testing.T) {
+	r := &lineRing{lines: make([]string, 3)}
+	if lines := r.snapshot(); len(lines) != 0 {
+		t.Errorf("Expected empty ring, got %q", lines)
+	}
+
+	for _, line := range []string{"1", "2", "3", "4", "5"} {
+		r.add([]byte(line))
+	}
+	if expected := []string{"3", "4", "5"}; !reflect.DeepEqual(r.snapshot(), expected) {
+		t.Errorf("Expected %q, got %q", expected, r.snapshot())
+	}
+}
+
+func TestOutputTailPrint(t *testing.T) {
+	tail := newOutputTail(2)
+	tail.stdout.Write([]byte("a\nb\nc\npartial"))
+	tail.stderr.Write([]byte("err\n"))
+
+	var buf SafeBuffer
+	tail.print(&buf, "make", ReasonTimeout, 1500*time.Millisecond, []string{"TERM", "KILL"})
+
+	output := buf.String()
+	expectedStrings := []string{
+		"command 'make' stopped (timeout) after 1.5s; signals sent: TERM, KILL",
+		"---- last 2 lines of stdout ----\nc\npartial\n",
+		"---- last 1 lines of stderr ----\nerr\n",
+		"==== end of timeout summary ====",
+	}
+	for _, expected := range expectedStrings {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Summary missing %q:\n%s", expected, output)
+		}
+	}
+}
+
+func TestRunTimeoutTailOnTimeout(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName:    "TERM",
+		TailOnTimeout: "2",
+		Stdout:        &stdout,
+		Stderr:        &stderr,
+	}
+
+	result := runTimeout(config, []string{"0.3s", "sh", "-c", "for i in 1 2 3 4; do echo line $i; done; echo oops >&2; exec sleep 5"})
+
+	if result.ExitCode != 124 {
+		t.Errorf("Expected exit code 124, got %d", result.ExitCode)
+	}
+	if !reflect.DeepEqual(result.Signals, []string{"TERM"}) {
+		t.Errorf("Expected signals [TERM], got %q", result.Signals)
+	}
+	if result.Elapsed < 300*time.Millisecond {
+		t.Errorf("Expected elapsed time of at least the timeout, got %v", result.Elapsed)
+	}
+
+	// stdout passes through unchanged, the summary goes to stderr
+	if strings.Contains(stdout.String(), "====") || !strings.Contains(stdout.String(), "line 1") {
+		t.Errorf("Unexpected stdout: %q", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "---- last 2 lines of stdout ----\nline 3\nline 4\n") {
+		t.Errorf("Expected tail of stdout in summary, got %q", stderr.String())
+	}
+}
+
+func TestRunTimeoutTailNotPrintedOnSuccess(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName:    "TERM",
+		TailOnTimeout: "5",
+		Stdout:        &stdout,
+		Stderr:        &stderr,
+	}
+
+	result := runTimeout(config, []string{"5s", "echo", "hello"})
+
+	if result.ExitCode != 0 {
+		t.Errorf("Expected exit code 0, got %d", result.ExitCode)
+	}
+	if strings.Contains(stderr.String(), "timeout summary") {
+		t.Errorf("Summary should only be printed on timeout, got %q", stderr.String())
+	}
+}
+
+func TestRunTimeoutTailInvalid(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName:    "TERM",
+		TailOnTimeout: "-1",
+		Stdout:        &stdout,
+		Stderr:        &stderr,
+	}
+
+	result := runTimeout(config, []string{"5s", "true"})
+
+	if result.ExitCode != 125 {
+		t.Errorf("Expected exit code 125 for invalid line count, got %d", result.ExitCode)
+	}
+}
+
+func TestRunTimeoutTimestamps(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", Timestamps: TimestampsElapsed, Prefix: "job| ", Stdout: &stdout, Stderr: &stderr}
+	clock := newFakeClock()
+	proc := newFakeProcess(exitOn(-1, syscall.SIGTERM))
+	starter := &fakeStarter{proc: proc}
+	config.Clock = clock
+	config.Starter = starter
+
+	results := make(chan Result, 1)
+	go func() {
+		results <- runTimeout(config, []string{"10s", "job"})
+	}()
+	clock.WaitForTimers(t, 1)
+
+	clock.Advance(1500 * time.Millisecond)
+	starter.spec.Stdout.Write([]byte("hello\npart"))
+	starter.spec.Stderr.Write([]byte("oops\n"))
+	clock.Advance(8500 * time.Millisecond)
+	waitResult(t, results)
+
+	expectedStdout := "    1.500s job| hello\n" +
+		"   10.000s job| part\n" +
+		"   10.000s job| *** timeout: sending signal TERM ***\n"
+	if stdout.String() != expectedStdout {
+		t.Errorf("Expected stdout:\n%s\ngot:\n%s", expectedStdout, stdout.String())
+	}
+
+	expectedStderr := "    1.500s job| oops\n" +
+		"   10.000s job| *** timeout: sending signal TERM ***\n"
+	if stderr.String() != expectedStderr {
+		t.Errorf("Expected stderr:\n%s\ngot:\n%s", expectedStderr, stderr.String())
+	}
+}
+
+func TestRunTimeoutTimestampsRFC3339(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", Timestamps: TimestampsRFC3339, Stdout: &stdout, Stderr: &stderr}
+
+	result := runTimeout(config, []string{"5s", "sh", "-c", "echo one; printf two"})
+
+	if result.ExitCode != 0 {
+		t.Errorf("Expected exit code 0, got %d", result.ExitCode)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected the partial line to be flushed on exit, got %q", stdout.String())
+	}
+	for i, expected := range []string{"one", "two"} {
+		stamp, text, _ := strings.Cut(lines[i], " ")
+		if _, err := time.Parse(time.RFC3339, stamp); err != nil {
+			t.Errorf("Invalid timestamp %q: %v", stamp, err)
+		}
+		if text != expected {
+			t.Errorf("Expected %q, got %q", expected, text)
+		}
+	}
+}
+
+func TestRunTimeoutPrefixOnly(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", Prefix: "[app] ", Stdout: &stdout, Stderr: &stderr}
+
+	runTimeout(config, []string{"5s", "sh", "-c", "echo out; echo err >&2"})
+
+	if stdout.String() != "[app] out\n" {
+		t.Errorf("Expected prefixed stdout, got %q", stdout.String())
+	}
+	if stderr.String() != "[app] err\n" {
+		t.Errorf("Expected prefixed stderr, got %q", stderr.String())
+	}
+}
+
+func TestRunTimeoutTimestampsInvalid(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", Timestamps: "unix", Stdout: &stdout, Stderr: &stderr}
+
+	result := runTimeout(config, []string{"5s", "true"})
+
+	if result.ExitCode != 125 {
+		t.Errorf("Expected exit code 125 for an invalid timestamp format, got %d", result.ExitCode)
+	}
+}
+
+func TestParseOutputLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		max      int64
+		truncate bool
+		hasError bool
+	}{
+		{"none", Config{}, 0, false, false},
+		{"kill", Config{MaxOutput: "1K"}, 1024, false, false},
+		{"explicit kill", Config{MaxOutput: "10", MaxOutputAction: "kill"}, 10, false, false},
+		{"truncate", Config{MaxOutput: "2M", MaxOutputAction: "truncate"}, 2 << 20, true, false},
+		{"zero", Config{MaxOutput: "0"}, 0, false, false},
+
+		{"invalid size", Config{MaxOutput: "big"}, 0, false, true},
+		{"invalid action", Config{MaxOutput: "1K", MaxOutputAction: "ignore"}, 0, false, true},
+		{"action without limit", Config{MaxOutputAction: "truncate"}, 0, false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l, err := parseOutputLimit(test.config)
+
+			if test.hasError {
+				if err == nil {
+					t.Errorf("Expected error, but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+
+			if test.max == 0 {
+				if l != nil {
+					t.Errorf("Expected no limit, got %d", l.max)
+				}
+				return
+			}
+
+			if l == nil || l.max != test.max || l.truncate != test.truncate {
+				t.Errorf("Expected limit %d (truncate %v), got %+v", test.max, test.truncate, l)
+			}
+		})
+	}
+}
+
+func TestOutputLimitWriters(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	l := &outputLimit{max: 10, exceeded: make(chan struct{})}
+	out, errOut := l.wrap(&stdout), l.wrap(&stderr)
+
+	out.Write([]byte("12345"))
+	errOut.Write([]byte("678"))
+	select {
+	case <-l.exceeded:
+		t.Fatalf("Limit should not be exceeded yet")
+	default:
+	}
+
+	// The streams share the limit: only two more bytes fit
+	if n, err := out.Write([]byte("abcdef")); n != 6 || err != nil {
+		t.Errorf("Writes past the limit should still succeed, got %d, %v", n, err)
+	}
+	errOut.Write([]byte("more"))
+
+	select {
+	case <-l.exceeded:
+	default:
+		t.Errorf("Limit should be exceeded")
+	}
+	if stdout.String() != "12345ab" || stderr.String() != "678" {
+		t.Errorf("Expected output cut at 10 bytes, got %q and %q", stdout.String(), stderr.String())
+	}
+}
+
+func TestRunTimeoutMaxOutputKill(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", MaxOutput: "1K", Stdout: &stdout, Stderr: &stderr}
+
+	start := time.Now()
+	result := runTimeout(config, []string{"10s", "sh", "-c", "while :; do echo spam; done"})
+
+	if result.ExitCode != 124 || result.Reason != ReasonOutputLimit {
+		t.Errorf("Expected exit code 124 with reason %q, got %d %q", ReasonOutputLimit, result.ExitCode, result.Reason)
+	}
+	if stdout.Len() > 1024 {
+		t.Errorf("Expected at most 1024 bytes of output, got %d", stdout.Len())
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Command should be stopped early, took %v", elapsed)
+	}
+}
+
+func TestRunTimeoutMaxOutputTruncate(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", MaxOutput: "10", MaxOutputAction: "truncate", Stdout: &stdout, Stderr: &stderr}
+
+	result := runTimeout(config, []string{"5s", "sh", "-c", "echo 0123456789abcdef; exit 4"})
+
+	if result.ExitCode != 4 || result.Reason != ReasonCompleted {
+		t.Errorf("Expected the command to finish with 4, got %d %q", result.ExitCode, result.Reason)
+	}
+	if !result.Truncated {
+		t.Errorf("Expected the result to report truncation")
+	}
+	if stdout.String() != "0123456789" {
+		t.Errorf("Expected output cut at 10 bytes, got %q", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "truncated after 10 bytes") {
+		t.Errorf("Expected a truncation notice, got %q", stderr.String())
+	}
+}
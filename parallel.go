@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// parallelSeparator separates the commands given to --parallel
+const parallelSeparator = ":::"
+
+// splitCommands splits the operands following DURATION into commands at
+// every ":::" separator
+func splitCommands(args []string) ([][]string, error) {
+	var commands [][]string
+	start := 0
+	for i := 0; i <= len(args); i++ {
+		if i < len(args) && args[i] != parallelSeparator {
+			continue
+		}
+		if i == start {
+			return nil, fmt.Errorf("empty command in '%s' list", parallelSeparator)
+		}
+		commands = append(commands, args[start:i])
+		start = i + 1
+	}
+	return commands, nil
+}
+
+// syncWriter serialises the lines that parallel commands write to w
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// newPrefixWriter returns a lineWriter copying every line to out with
+// prefix in front of it
+func newPrefixWriter(out *syncWriter, prefix string) *lineWriter {
+	return newLineWriter(func(line []byte) {
+		out.mu.Lock()
+		defer out.mu.Unlock()
+		if out.w != nil {
+			fmt.Fprintf(out.w, "%s%s\n", prefix, line)
+		}
+	})
+}
+
+// runParallel runs every command of args at once, each with the DURATION
+// and options of config. The exit status is that of the first command to
+// fail, or 0 when all of them succeed.
+func runParallel(config Config, args []string) Result {
+	commands, err := splitCommands(args[1:])
+	if err != nil {
+		fmt.Fprintf(config.Stderr, "timeout: %v\n", err)
+		return Result{ExitCode: 125}
+	}
+
+	// The writers are pointed at stdout, stderr or the logs once every
+	// option has been checked
+	stdout := &syncWriter{}
+	stderr := &syncWriter{}
+
+	executions := make([]*execution, len(commands))
+	stops := make([]chan string, len(commands))
+	outputs := make([][]*lineWriter, len(commands))
+	for i, command := range commands {
+		prefix := fmt.Sprintf("[%d:%s] ", i+1, filepath.Base(command[0]))
+		out := newPrefixWriter(stdout, prefix)
+		errOut := newPrefixWriter(stderr, prefix)
+
+		// Only one command could read stdin, so none of them does
+		c := config
+		c.Stdout = out
+		c.Stderr = errOut
+		c.Stdin = nil
+		if c.Logger != nil {
+			c.Logger = c.Logger.With("index", i+1)
+		}
+
+		e, err := newExecution(c, args[0], command[0])
+		if err != nil {
+			fmt.Fprintf(config.Stderr, "timeout: %v\n", err)
+			return Result{ExitCode: 125}
+		}
+		stops[i] = make(chan string, 1)
+		e.stop = stops[i]
+		executions[i] = e
+		outputs[i] = []*lineWriter{out, errOut}
+	}
+
+	// Parse the deadline shared by all commands
+	var deadline time.Duration
+	if config.Deadline != "" {
+		d, err := parseDuration(config.Deadline)
+		if err != nil {
+			fmt.Fprintf(config.Stderr, "timeout: invalid time interval '%s': %v\n", config.Deadline, err)
+			return Result{ExitCode: 125}
+		}
+		scale, _ := parseScale(config.Scale) // validated by newExecution
+		deadline = scaleOption(config, "deadline", d, scale)
+	}
+
+	files, err := openOutputFiles(config)
+	if err != nil {
+		fmt.Fprintf(config.Stderr, "timeout: %v\n", err)
+		return Result{ExitCode: 125}
+	}
+	stdout.w, stderr.w = files.writers(config.Stdout, config.Stderr)
+
+	type finished struct {
+		index  int
+		result Result
+	}
+	start := config.Clock.Now()
+	done := make(chan finished, len(commands))
+	for i, e := range executions {
+		go func(i int, e *execution, command []string) {
+			result := e.run(ProcessSpec{Name: command[0], Args: command[1:]})
+			for _, w := range outputs[i] {
+				w.Flush()
+			}
+			done <- finished{i, result}
+		}(i, e, commands[i])
+	}
+
+	var expired <-chan time.Time
+	if deadline > 0 {
+		timer := config.Clock.NewTimer(deadline)
+		defer timer.Stop()
+		expired = timer.C()
+	}
+
+	stopAll := func(reason string) {
+		for _, stop := range stops {
+			select {
+			case stop <- reason:
+			default:
+			}
+		}
+	}
+
+	results := make([]Result, len(commands))
+	failed := -1
+	for remaining := len(commands); remaining > 0; {
+		select {
+		case <-expired:
+			loggerFor(config).Info(fmt.Sprintf("deadline of %s reached, stopping all commands", deadline),
+				"event", "deadline-reached", "deadline", deadline)
+			stopAll(ReasonDeadline)
+			expired = nil
+		case f := <-done:
+			remaining--
+			results[f.index] = f.result
+			if f.result.ExitCode == 0 || failed >= 0 {
+				continue
+			}
+			failed = f.index
+			if config.FailFast {
+				loggerFor(config).Info(fmt.Sprintf("command %d failed, stopping the others", f.index+1),
+					"event", "fail-fast", "index", f.index+1)
+				stopAll(ReasonCancelled)
+			}
+		}
+	}
+
+	if err := files.Close(); err != nil {
+		fmt.Fprintf(config.Stderr, "timeout: %v\n", err)
+	}
+
+	result := Result{
+		ExitCode: 0,
+		Reason:   ReasonCompleted,
+		Elapsed:  config.Clock.Now().Sub(start),
+		Limit:    deadline,
+		Start:    start,
+		Command:  args[1:],
+		Commands: results,
+	}
+	if failed >= 0 {
+		result.ExitCode = results[failed].ExitCode
+		result.Reason = results[failed].Reason
+		result.StdoutTail = results[failed].StdoutTail
+		result.StderrTail = results[failed].StderrTail
+	}
+	for _, r := range results {
+		result.MaxRSS = max(result.MaxRSS, r.MaxRSS)
+	}
+	return finish(config, args[1:], result)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected [][]string
+		hasError bool
+	}{
+		{"single", []string{"sleep", "1"}, [][]string{{"sleep", "1"}}, false},
+		{"two", []string{"make", "lint", ":::", "make", "test"}, [][]string{{"make", "lint"}, {"make", "test"}}, false},
+		{"three", []string{"a", ":::", "b", ":::", "c"}, [][]string{{"a"}, {"b"}, {"c"}}, false},
+
+		{"leading separator", []string{":::", "a"}, nil, true},
+		{"trailing separator", []string{"a", ":::"}, nil, true},
+		{"double separator", []string{"a", ":::", ":::", "b"}, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			commands, err := splitCommands(test.args)
+
+			if test.hasError {
+				if err == nil {
+					t.Errorf("Expected error, but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+
+			if !reflect.DeepEqual(commands, test.expected) {
+				t.Errorf("Expected %q, got %q", test.expected, commands)
+			}
+		})
+	}
+}
+
+func TestRunTimeoutParallel(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName: "TERM",
+		Parallel:   true,
+		Stdout:     &stdout,
+		Stderr:     &stderr,
+	}
+
+	result := runTimeout(config, []string{"5s", "echo", "one", ":::", "sh", "-c", "echo two >&2"})
+
+	if result.ExitCode != 0 {
+		t.Errorf("Expected exit code 0, got %d (stderr: %q)", result.ExitCode, stderr.String())
+	}
+	if len(result.Commands) != 2 {
+		t.Fatalf("Expected 2 command results, got %d", len(result.Commands))
+	}
+	if !strings.Contains(stdout.String(), "[1:echo] one\n") {
+		t.Errorf("Expected prefixed stdout, got %q", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "[2:sh] two\n") {
+		t.Errorf("Expected prefixed stderr, got %q", stderr.String())
+	}
+}
+
+func TestRunTimeoutParallelFailure(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName: "TERM",
+		Parallel:   true,
+		Stdout:     &stdout,
+		Stderr:     &stderr,
+	}
+
+	result := runTimeout(config, []string{"5s", "true", ":::", "sh", "-c", "exit 3", ":::", "sleep", "0.2"})
+
+	if result.ExitCode != 3 {
+		t.Errorf("Expected the failing command's exit code 3, got %d", result.ExitCode)
+	}
+	if result.Commands[2].ExitCode != 0 {
+		t.Errorf("Without --fail-fast the other commands should finish, got %d", result.Commands[2].ExitCode)
+	}
+}
+
+func TestRunTimeoutParallelFailFast(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName: "TERM",
+		Parallel:   true,
+		FailFast:   true,
+		Stdout:     &stdout,
+		Stderr:     &stderr,
+	}
+
+	start := time.Now()
+	result := runTimeout(config, []string{"10s", "sh", "-c", "exit 3", ":::", "sleep", "5"})
+
+	if result.ExitCode != 3 {
+		t.Errorf("Expected the failing command's exit code 3, got %d", result.ExitCode)
+	}
+	if result.Commands[1].Reason != ReasonCancelled || result.Commands[1].ExitCode != 124 {
+		t.Errorf("Expected the sibling to be cancelled with 124, got %d %q", result.Commands[1].ExitCode, result.Commands[1].Reason)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Sibling should have been stopped early, took %v", elapsed)
+	}
+}
+
+func TestRunTimeoutParallelDeadline(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	report := filepath.Join(t.TempDir(), "report.json")
+	config := Config{
+		SignalName: "TERM",
+		Parallel:   true,
+		Deadline:   "0.2s",
+		Report:     report,
+		Stdout:     &stdout,
+		Stderr:     &stderr,
+	}
+
+	result := runTimeout(config, []string{"10s", "sleep", "5", ":::", "true"})
+
+	if result.ExitCode != 124 || result.Reason != ReasonDeadline {
+		t.Errorf("Expected exit code 124 with reason %q, got %d %q", ReasonDeadline, result.ExitCode, result.Reason)
+	}
+
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	var r jsonReport
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatalf("Invalid report: %v", err)
+	}
+	if len(r.Commands) != 2 {
+		t.Fatalf("Expected 2 commands in the report, got %d", len(r.Commands))
+	}
+	if r.Commands[0].Reason != ReasonDeadline || r.Commands[1].Reason != ReasonCompleted {
+		t.Errorf("Unexpected command reasons %q and %q", r.Commands[0].Reason, r.Commands[1].Reason)
+	}
+	if strings.Join(r.Commands[0].Command, " ") != "sleep 5" {
+		t.Errorf("Expected command 'sleep 5', got %q", r.Commands[0].Command)
+	}
+}
+
+func TestRunTimeoutParallelInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		args   []string
+	}{
+		{"empty command", Config{Parallel: true}, []string{"5s", "true", ":::"}},
+		{"invalid deadline", Config{Parallel: true, Deadline: "soon"}, []string{"5s", "true"}},
+		{"invalid duration", Config{Parallel: true}, []string{"soon", "true"}},
+		{"deadline without parallel", Config{Deadline: "5s"}, []string{"5s", "true"}},
+		{"fail-fast without parallel", Config{FailFast: true}, []string{"5s", "true"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr SafeBuffer
+			config := test.config
+			config.SignalName = "TERM"
+			config.Stdout = &stdout
+			config.Stderr = &stderr
+
+			result := runTimeout(config, test.args)
+
+			if result.ExitCode != 125 {
+				t.Errorf("Expected exit code 125, got %d", result.ExitCode)
+			}
+		})
+	}
+}
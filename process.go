@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// ProcessStarter starts the command supervised by runTimeout. Tests
+// substitute a fake starter whose processes react to signals on demand.
+type ProcessStarter interface {
+	Start(spec ProcessSpec) (Process, error)
+}
+
+// ProcessSpec describes the command to start
+type ProcessSpec struct {
+	Name   string
+	Args   []string
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Env holds NAME=VALUE pairs added to timeout's own environment
+	Env []string
+
+	// Group starts the command in a process group of its own, which is
+	// signalled as a whole. The command is then in the background of the
+	// terminal and stopped if it reads from it.
+	Group bool
+}
+
+// Process is a started command
+type Process interface {
+	Pid() int
+	Signal(sig os.Signal) error
+
+	// Wait waits for the process to exit. The error is only set when
+	// waiting failed, not when the process exited unsuccessfully.
+	Wait() (ExitStatus, error)
+}
+
+// ExitStatus describes how a process ended
+type ExitStatus struct {
+	// Code is the exit code, or -1 if the process was killed by a signal
+	Code int
+
+	// MaxRSS is the peak resident set size in bytes, 0 if unknown
+	MaxRSS int64
+}
+
+// execStarter starts commands with os/exec
+type execStarter struct{}
+
+func (execStarter) Start(spec ProcessSpec) (Process, error) {
+	cmd := exec.Command(spec.Name, spec.Args...)
+	cmd.Stdin = spec.Stdin
+	cmd.Stdout = spec.Stdout
+	cmd.Stderr = spec.Stderr
+	if len(spec.Env) > 0 {
+		cmd.Env = append(os.Environ(), spec.Env...)
+	}
+	if spec.Group {
+		cmd.SysProcAttr = backgroundAttr()
+	}
+	// Output that is not a file goes through pipes; do not wait on
+	// descendants still holding them once the command has exited
+	cmd.WaitDelay = time.Second
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &execProcess{cmd: cmd, group: spec.Group}, nil
+}
+
+// execProcess is a Process started by execStarter
+type execProcess struct {
+	cmd   *exec.Cmd
+	group bool
+}
+
+func (p *execProcess) Pid() int {
+	return p.cmd.Process.Pid
+}
+
+func (p *execProcess) Signal(sig os.Signal) error {
+	if s, ok := sig.(syscall.Signal); ok && p.group {
+		return syscall.Kill(-p.Pid(), s)
+	}
+	return p.cmd.Process.Signal(sig)
+}
+
+func (p *execProcess) Wait() (ExitStatus, error) {
+	err := p.cmd.Wait()
+	if _, ok := err.(*exec.ExitError); ok || errors.Is(err, exec.ErrWaitDelay) {
+		err = nil
+	}
+
+	// Without a process state the command is treated as failed
+	status := ExitStatus{Code: 1}
+	if p.cmd.ProcessState != nil {
+		status.Code = p.cmd.ProcessState.ExitCode()
+		status.MaxRSS = maxRSS(p.cmd.ProcessState)
+	}
+	return status, err
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeProcess is a Process that exits when told to, either directly or from
+// its onSignal handler
+type fakeProcess struct {
+	mu       sync.Mutex
+	signals  []os.Signal
+	onSignal func(p *fakeProcess, sig os.Signal)
+	exit     chan ExitStatus
+	once     sync.Once
+}
+
+func newFakeProcess(onSignal func(p *fakeProcess, sig os.Signal)) *fakeProcess {
+	return &fakeProcess{onSignal: onSignal, exit: make(chan ExitStatus, 1)}
+}
+
+// exitOn returns an onSignal handler that exits with code on any of sigs
+func exitOn(code int, sigs ...os.Signal) func(p *fakeProcess, sig os.Signal) {
+	return func(p *fakeProcess, sig os.Signal) {
+		for _, s := range sigs {
+			if s == sig {
+				p.Exit(code)
+			}
+		}
+	}
+}
+
+func (p *fakeProcess) Pid() int {
+	return 4242
+}
+
+func (p *fakeProcess) Signal(sig os.Signal) error {
+	p.mu.Lock()
+	p.signals = append(p.signals, sig)
+	onSignal := p.onSignal
+	p.mu.Unlock()
+
+	if onSignal != nil {
+		onSignal(p, sig)
+	}
+	return nil
+}
+
+func (p *fakeProcess) Wait() (ExitStatus, error) {
+	return <-p.exit, nil
+}
+
+// Exit makes Wait return code; later calls are ignored
+func (p *fakeProcess) Exit(code int) {
+	p.once.Do(func() {
+		p.exit <- ExitStatus{Code: code}
+	})
+}
+
+// fakeStarter hands out a prepared fakeProcess
+type fakeStarter struct {
+	proc *fakeProcess
+	err  error
+	spec ProcessSpec
+}
+
+func (s *fakeStarter) Start(spec ProcessSpec) (Process, error) {
+	s.spec = spec
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.proc, nil
+}
+
+func TestExecStarter(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"success", []string{"-c", "exit 0"}, 0},
+		{"failure", []string{"-c", "exit 3"}, 3},
+		{"killed", []string{"-c", "kill -KILL $$"}, -1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proc, err := execStarter{}.Start(ProcessSpec{Name: "sh", Args: test.args})
+			if err != nil {
+				t.Fatalf("Failed to start: %v", err)
+			}
+
+			status, err := proc.Wait()
+			if err != nil {
+				t.Errorf("Unexpected wait error: %v", err)
+			}
+			if status.Code != test.code {
+				t.Errorf("Expected exit code %d, got %d", test.code, status.Code)
+			}
+		})
+	}
+}
+
+func TestExecStarterSignal(t *testing.T) {
+	proc, err := execStarter{}.Start(ProcessSpec{Name: "sleep", Args: []string{"5"}})
+	if err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	if proc.Pid() <= 0 {
+		t.Errorf("Expected a pid, got %d", proc.Pid())
+	}
+
+	if err := proc.Signal(syscall.SIGTERM); err != nil {
+		t.Errorf("Unexpected signal error: %v", err)
+	}
+	if status, _ := proc.Wait(); status.Code != -1 {
+		t.Errorf("Expected exit code -1 for a signalled process, got %d", status.Code)
+	}
+}
+
+func TestExecStarterDescendantHoldsOutput(t *testing.T) {
+	var stdout SafeBuffer
+	proc, err := execStarter{}.Start(ProcessSpec{Name: "sh", Args: []string{"-c", "sleep 10 & echo hi"}, Stdout: &stdout})
+	if err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+
+	start := time.Now()
+	status, err := proc.Wait()
+	if err != nil {
+		t.Errorf("Unexpected wait error: %v", err)
+	}
+	if status.Code != 0 {
+		t.Errorf("Expected exit code 0, got %d", status.Code)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected Wait not to wait for the background sleep, took %v", elapsed)
+	}
+	if stdout.String() != "hi\n" {
+		t.Errorf("Expected output %q, got %q", "hi\n", stdout.String())
+	}
+}
+
+func TestExecStarterGroup(t *testing.T) {
+	var stdout SafeBuffer
+	proc, err := execStarter{}.Start(ProcessSpec{Name: "sh", Args: []string{"-c", "sleep 10 & wait"}, Stdout: &stdout, Group: true})
+	if err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	if pgid, err := syscall.Getpgid(proc.Pid()); err != nil || pgid != proc.Pid() {
+		t.Errorf("Expected the command to lead its own process group, got %d (%v)", pgid, err)
+	}
+
+	// The background sleep is signalled along with the shell, so it does
+	// not hold the output pipe open
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	if err := proc.Signal(syscall.SIGTERM); err != nil {
+		t.Errorf("Unexpected signal error: %v", err)
+	}
+	proc.Wait()
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the whole group to be stopped at once, took %v", elapsed)
+	}
+}
+
+func TestExecStarterNotFound(t *testing.T) {
+	_, err := execStarter{}.Start(ProcessSpec{Name: "/nonexistent/command"})
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected a not-exist error, got %v", err)
+	}
+}
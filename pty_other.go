@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+// ptyStarter is unavailable where pseudo-terminals are not implemented
+type ptyStarter struct{}
+
+func (ptyStarter) Start(spec ProcessSpec) (Process, error) {
+	return nil, errors.New("--pty is not supported on this platform")
+}
@@ -0,0 +1,81 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunTimeoutPty(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", Pty: true, Stdout: &stdout, Stderr: &stderr}
+
+	result := runTimeout(config, []string{"5s", "sh", "-c", "test -t 0 && test -t 1 && test -t 2 && echo tty; echo err >&2; exit 3"})
+
+	if result.ExitCode != 3 {
+		t.Errorf("Expected exit code 3, got %d (stderr: %q)", result.ExitCode, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "tty\r\n") {
+		t.Errorf("Command should see a terminal, got %q", stdout.String())
+	}
+	if !strings.Contains(stdout.String(), "err") {
+		t.Errorf("Stderr should be written to the terminal too, got %q", stdout.String())
+	}
+}
+
+func TestRunTimeoutPtySize(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", Pty: true, Stdout: &stdout, Stderr: &stderr}
+
+	result := runTimeout(config, []string{"5s", "stty", "size"})
+
+	if result.ExitCode != 0 {
+		t.Errorf("Expected exit code 0, got %d", result.ExitCode)
+	}
+	if strings.TrimSpace(stdout.String()) != "24 80" {
+		t.Errorf("Expected the default size 24 80, got %q", stdout.String())
+	}
+}
+
+func TestRunTimeoutPtyStdin(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName: "TERM",
+		Pty:        true,
+		Stdin:      strings.NewReader("hello\n"),
+		Stdout:     &stdout,
+		Stderr:     &stderr,
+	}
+
+	result := runTimeout(config, []string{"5s", "sh", "-c", "read line && echo got $line && cat"})
+
+	if result.ExitCode != 0 {
+		t.Errorf("Expected cat to see end of input, got exit code %d", result.ExitCode)
+	}
+	if !strings.Contains(stdout.String(), "got hello") {
+		t.Errorf("Expected input to reach the command, got %q", stdout.String())
+	}
+}
+
+func TestRunTimeoutPtyProcessGroup(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	marker := filepath.Join(t.TempDir(), "survived")
+	config := Config{SignalName: "TERM", Pty: true, Stdout: &stdout, Stderr: &stderr}
+
+	result := runTimeout(config, []string{"0.2s", "sh", "-c", "(sleep 0.5; touch " + marker + ") & wait"})
+
+	if result.ExitCode != 124 {
+		t.Errorf("Expected exit code 124, got %d", result.ExitCode)
+	}
+
+	// The background job is in the command's process group, so it was
+	// signalled along with the shell and never creates the marker
+	time.Sleep(time.Second)
+	if _, err := os.Stat(marker); err == nil {
+		t.Errorf("Background process survived the timeout")
+	}
+}
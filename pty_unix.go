@@ -0,0 +1,193 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// ptyDrainDelay bounds how long output is still read from the terminal once
+// the command has exited, in case a background process keeps it open
+const ptyDrainDelay = time.Second
+
+// winsize is the terminal size exchanged with TIOCGWINSZ and TIOCSWINSZ
+type winsize struct {
+	Row, Col, Xpixel, Ypixel uint16
+}
+
+// ptyStarter starts commands on a new pseudo-terminal, as the leader of
+// their own session and process group
+type ptyStarter struct{}
+
+func (ptyStarter) Start(spec ProcessSpec) (Process, error) {
+	master, slave, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+	defer slave.Close()
+
+	// Give the command the size of our terminal, or 80x24 without one
+	terminal, _ := spec.Stdin.(*os.File)
+	if terminal != nil && !isTerminal(terminal) {
+		terminal = nil
+	}
+	size := winsize{Row: 24, Col: 80}
+	if terminal != nil {
+		if err := ioctl(terminal, syscall.TIOCGWINSZ, unsafe.Pointer(&size)); err != nil {
+			size = winsize{Row: 24, Col: 80}
+		}
+	}
+	ioctl(master, syscall.TIOCSWINSZ, unsafe.Pointer(&size))
+
+	cmd := exec.Command(spec.Name, spec.Args...)
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+	cmd.Stderr = slave
+	if len(spec.Env) > 0 {
+		cmd.Env = append(os.Environ(), spec.Env...)
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	if err := cmd.Start(); err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	p := &ptyProcess{
+		execProcess: execProcess{cmd: cmd},
+		master:      master,
+		output:      make(chan struct{}),
+		winch:       make(chan os.Signal, 1),
+	}
+
+	// Keystrokes go to the command unprocessed; its terminal echoes them
+	if terminal != nil {
+		if state, err := makeRaw(terminal); err == nil {
+			p.terminal = terminal
+			p.state = state
+		}
+		signal.Notify(p.winch, syscall.SIGWINCH)
+		go p.resize(terminal)
+	}
+
+	go func() {
+		defer close(p.output)
+		if spec.Stdout != nil {
+			io.Copy(spec.Stdout, master)
+		} else {
+			io.Copy(io.Discard, master)
+		}
+	}()
+	if spec.Stdin != nil {
+		go func() {
+			// Pass end of input on as the terminal's EOF character
+			io.Copy(master, spec.Stdin)
+			master.Write([]byte{4})
+		}()
+	}
+	return p, nil
+}
+
+// ptyProcess is a Process started by ptyStarter
+type ptyProcess struct {
+	execProcess
+	master *os.File
+	output chan struct{}
+	winch  chan os.Signal
+
+	// terminal is our own terminal, put in raw mode until the command exits
+	terminal *os.File
+	state    *syscall.Termios
+}
+
+// Signal delivers sig to the command's whole process group
+func (p *ptyProcess) Signal(sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return p.execProcess.Signal(sig)
+	}
+	return syscall.Kill(-p.Pid(), s)
+}
+
+func (p *ptyProcess) Wait() (ExitStatus, error) {
+	status, err := p.execProcess.Wait()
+
+	// Read what the command wrote before it exited, then stop copying
+	select {
+	case <-p.output:
+	case <-time.After(ptyDrainDelay):
+	}
+	p.master.Close()
+	<-p.output
+
+	signal.Stop(p.winch)
+	close(p.winch)
+	if p.state != nil {
+		ioctl(p.terminal, ioctlSetTermios, unsafe.Pointer(p.state))
+	}
+	return status, err
+}
+
+// resize copies the size of terminal to the command's terminal whenever it
+// changes
+func (p *ptyProcess) resize(terminal *os.File) {
+	for range p.winch {
+		var size winsize
+		if ioctl(terminal, syscall.TIOCGWINSZ, unsafe.Pointer(&size)) == nil {
+			ioctl(p.master, syscall.TIOCSWINSZ, unsafe.Pointer(&size))
+		}
+	}
+}
+
+// isTerminal reports whether f is a terminal
+func isTerminal(f *os.File) bool {
+	var t syscall.Termios
+	return ioctl(f, ioctlGetTermios, unsafe.Pointer(&t)) == nil
+}
+
+// makeRaw puts terminal in raw mode, as cfmakeraw does, and returns its
+// previous attributes
+func makeRaw(terminal *os.File) (*syscall.Termios, error) {
+	var state syscall.Termios
+	if err := ioctl(terminal, ioctlGetTermios, unsafe.Pointer(&state)); err != nil {
+		return nil, err
+	}
+
+	raw := state
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Oflag &^= syscall.OPOST
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctl(terminal, ioctlSetTermios, unsafe.Pointer(&raw)); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// ioctl performs an ioctl on f without putting it in blocking mode, so that
+// closing f still interrupts pending reads
+func ioctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	err = conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"sync/atomic"
+	"time"
+)
+
+// ExitNotReady is the exit status used when the command does not pass its
+// readiness probes within --ready-timeout.
+const ExitNotReady = 123
+
+// readyPollInterval is how often the polling probes are retried
+const readyPollInterval = 100 * time.Millisecond
+
+// readyProbe reports whether one readiness condition currently holds
+type readyProbe func(ctx context.Context) bool
+
+// readiness holds the probes that gate the start of the main timeout
+type readiness struct {
+	timeout time.Duration
+	probes  []readyProbe
+
+	// stdout is non-nil when --ready-stdout-regex is set and must be
+	// fed a copy of the command's standard output.
+	stdout *lineWriter
+}
+
+// parseReadiness builds the readiness probes from config, scaling the ready
+// timeout by scale. It returns nil when no probe is configured.
+func parseReadiness(config Config, scale float64) (*readiness, error) {
+	r := &readiness{}
+
+	if config.ReadyTCP != "" {
+		addr := config.ReadyTCP
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return nil, fmt.Errorf("invalid ready address '%s'", addr)
+		}
+		r.probes = append(r.probes, func(ctx context.Context) bool {
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, "tcp", addr)
+			if err != nil {
+				return false
+			}
+			conn.Close()
+			return true
+		})
+	}
+
+	if config.ReadyFile != "" {
+		path := config.ReadyFile
+		r.probes = append(r.probes, func(ctx context.Context) bool {
+			_, err := os.Stat(path)
+			return err == nil
+		})
+	}
+
+	if config.ReadyStdoutRegex != "" {
+		re, err := regexp.Compile(config.ReadyStdoutRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ready regex '%s': %v", config.ReadyStdoutRegex, err)
+		}
+		var matched atomic.Bool
+		r.stdout = newLineWriter(func(line []byte) {
+			if re.Match(line) {
+				matched.Store(true)
+			}
+		})
+		r.probes = append(r.probes, func(ctx context.Context) bool {
+			return matched.Load()
+		})
+	}
+
+	if config.ReadyCmd != "" {
+		script := config.ReadyCmd
+		r.probes = append(r.probes, func(ctx context.Context) bool {
+			return exec.CommandContext(ctx, "sh", "-c", script).Run() == nil
+		})
+	}
+
+	if config.ReadyTimeout != "" {
+		d, err := parseDuration(config.ReadyTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time interval '%s': %v", config.ReadyTimeout, err)
+		}
+		if len(r.probes) == 0 {
+			return nil, fmt.Errorf("--ready-timeout requires a readiness probe")
+		}
+		r.timeout = scaleOption(config, "ready-timeout", d, scale)
+	}
+
+	if len(r.probes) == 0 {
+		return nil, nil
+	}
+	return r, nil
+}
+
+// wait polls the probes until all of them pass or ctx is done
+func (r *readiness) wait(ctx context.Context) error {
+	ticker := time.NewTicker(readyPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if r.check(ctx) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// check runs every probe once and reports whether all of them passed
+func (r *readiness) check(ctx context.Context) bool {
+	for _, probe := range r.probes {
+		if !probe(ctx) {
+			return false
+		}
+	}
+	return true
+}
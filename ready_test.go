@@ -0,0 +1,203 @@
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseReadiness(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		probes   int
+		hasError bool
+	}{
+		{"none", Config{}, 0, false},
+		{"tcp", Config{ReadyTCP: "localhost:8080"}, 1, false},
+		{"file", Config{ReadyFile: "/tmp/ready"}, 1, false},
+		{"regex", Config{ReadyStdoutRegex: "listening on"}, 1, false},
+		{"cmd", Config{ReadyCmd: "true"}, 1, false},
+		{"combined", Config{ReadyTCP: ":80", ReadyFile: "/tmp/ready", ReadyTimeout: "10s"}, 2, false},
+
+		{"invalid tcp", Config{ReadyTCP: "localhost"}, 0, true},
+		{"invalid regex", Config{ReadyStdoutRegex: "("}, 0, true},
+		{"invalid timeout", Config{ReadyFile: "/tmp/ready", ReadyTimeout: "soon"}, 0, true},
+		{"timeout without probe", Config{ReadyTimeout: "10s"}, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := parseReadiness(test.config, 1)
+
+			if test.hasError {
+				if err == nil {
+					t.Errorf("Expected error, but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+
+			if test.probes == 0 {
+				if r != nil {
+					t.Errorf("Expected no readiness, got %d probes", len(r.probes))
+				}
+				return
+			}
+
+			if r == nil || len(r.probes) != test.probes {
+				t.Errorf("Expected %d probes, got %v", test.probes, r)
+			}
+		})
+	}
+}
+
+func TestRunTimeoutReadyFile(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	path := filepath.Join(t.TempDir(), "ready")
+	config := Config{
+		SignalName:   "TERM",
+		ReadyFile:    path,
+		ReadyTimeout: "5s",
+		Stdout:       &stdout,
+		Stderr:       &stderr,
+	}
+
+	// The main timeout only starts once the file exists, so the command
+	// outlives a DURATION shorter than its total run time.
+	start := time.Now()
+	result := runTimeout(config, []string{"0.3s", "sh", "-c", "sleep 0.3; touch " + path + "; sleep 0.1"})
+
+	if result.ExitCode != 0 {
+		t.Errorf("Expected exit code 0, got %d (stderr: %q)", result.ExitCode, stderr.String())
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("Command finished too quickly: %v", elapsed)
+	}
+}
+
+func TestRunTimeoutReadyTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName:   "TERM",
+		ReadyTCP:     ln.Addr().String(),
+		ReadyTimeout: "5s",
+		Stdout:       &stdout,
+		Stderr:       &stderr,
+	}
+
+	result := runTimeout(config, []string{"5s", "sleep", "0.2"})
+
+	if result.ExitCode != 0 {
+		t.Errorf("Expected exit code 0, got %d", result.ExitCode)
+	}
+}
+
+func TestRunTimeoutReadyStdoutRegex(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName:       "TERM",
+		ReadyStdoutRegex: "^listening on [0-9]+$",
+		ReadyTimeout:     "5s",
+		Stdout:           &stdout,
+		Stderr:           &stderr,
+	}
+
+	result := runTimeout(config, []string{"0.2s", "sh", "-c", "echo starting; echo listening on 8080; exec sleep 5"})
+
+	if result.ExitCode != 124 {
+		t.Errorf("Expected exit code 124 after main timeout, got %d", result.ExitCode)
+	}
+
+	if !strings.Contains(stdout.String(), "listening on 8080") {
+		t.Errorf("Command output should pass through unchanged, got %q", stdout.String())
+	}
+}
+
+func TestRunTimeoutNotReady(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName:   "TERM",
+		Verbose:      true,
+		ReadyFile:    filepath.Join(t.TempDir(), "never"),
+		ReadyTimeout: "0.2s",
+		Stdout:       &stdout,
+		Stderr:       &stderr,
+	}
+
+	result := runTimeout(config, []string{"10s", "sleep", "5"})
+
+	if result.ExitCode != ExitNotReady {
+		t.Errorf("Expected exit code %d when never ready, got %d", ExitNotReady, result.ExitCode)
+	}
+
+	if !strings.Contains(stderr.String(), "not ready") {
+		t.Errorf("Verbose output should report the readiness failure, got %q", stderr.String())
+	}
+}
+
+func TestRunTimeoutNotReadyWithinDuration(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName: "TERM",
+		ReadyFile:  filepath.Join(t.TempDir(), "never"),
+		Stdout:     &stdout,
+		Stderr:     &stderr,
+	}
+
+	// Without --ready-timeout, DURATION also bounds the wait for readiness
+	start := time.Now()
+	result := runTimeout(config, []string{"0.2s", "sleep", "5"})
+
+	if result.ExitCode != ExitNotReady {
+		t.Errorf("Expected exit code %d when never ready, got %d", ExitNotReady, result.ExitCode)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Expected the command to be stopped after DURATION, took %v", elapsed)
+	}
+}
+
+func TestRunTimeoutExitBeforeReady(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName:   "TERM",
+		ReadyCmd:     "false",
+		ReadyTimeout: "5s",
+		Stdout:       &stdout,
+		Stderr:       &stderr,
+	}
+
+	result := runTimeout(config, []string{"10s", "sh", "-c", "exit 3"})
+
+	if result.ExitCode != 3 {
+		t.Errorf("Expected the command's exit code 3, got %d", result.ExitCode)
+	}
+}
+
+func TestRunTimeoutReadyInvalid(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName:   "TERM",
+		ReadyTimeout: "5s",
+		Stdout:       &stdout,
+		Stderr:       &stderr,
+	}
+
+	result := runTimeout(config, []string{"10s", "true"})
+
+	if result.ExitCode != 125 {
+		t.Errorf("Expected exit code 125 for --ready-timeout without probe, got %d", result.ExitCode)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// jsonReport is the JSON document written by --report
+type jsonReport struct {
+	Name     string   `json:"name,omitempty"`
+	Command  []string `json:"command"`
+	ExitCode int      `json:"exit_code"`
+	Original *int     `json:"original_exit_code,omitempty"`
+	Reason   string   `json:"reason,omitempty"`
+	Matched  string   `json:"matched_line,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	Elapsed  float64  `json:"elapsed_seconds"`
+	Signals  []string `json:"signals_sent,omitempty"`
+	DumpFile string   `json:"dump_file,omitempty"`
+
+	Truncated bool `json:"output_truncated,omitempty"`
+
+	OnTimeout *hookReport `json:"on_timeout,omitempty"`
+
+	// Commands describes each command run by --parallel or run-steps
+	Commands []jsonReport `json:"commands,omitempty"`
+}
+
+// hookReport describes a hook command in the JSON report
+type hookReport struct {
+	ExitCode int    `json:"exit_code"`
+	Output   string `json:"output"`
+	Error    string `json:"error,omitempty"`
+}
+
+// newHookReport describes hook, or returns nil if it did not run
+func newHookReport(hook *HookResult) *hookReport {
+	if hook == nil {
+		return nil
+	}
+	r := &hookReport{ExitCode: hook.ExitCode, Output: hook.Output}
+	if hook.Error != nil {
+		r.Error = hook.Error.Error()
+	}
+	return r
+}
+
+// newReport describes the run of command that produced result
+func newReport(command []string, result Result) jsonReport {
+	r := jsonReport{
+		Name:     result.Name,
+		Command:  command,
+		ExitCode: result.ExitCode,
+		Reason:   result.Reason,
+		Matched:  result.Matched,
+		Elapsed:  result.Elapsed.Seconds(),
+		Signals:  result.Signals,
+		DumpFile: result.DumpFile,
+
+		Truncated: result.Truncated,
+
+		OnTimeout: newHookReport(result.OnTimeout),
+	}
+	if result.Remapped {
+		r.Original = &result.OriginalExitCode
+	}
+	if result.Error != nil {
+		r.Error = result.Error.Error()
+	}
+	for _, p := range result.Commands {
+		r.Commands = append(r.Commands, newReport(p.Command, p))
+	}
+	return r
+}
+
+// writeReport writes the JSON report for result to path
+func writeReport(path string, command []string, result Result) error {
+	// Command lines and output keep characters such as > and & as they are
+	var data bytes.Buffer
+	enc := json.NewEncoder(&data)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(newReport(command, result)); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data.Bytes(), 0644); err != nil {
+		return fmt.Errorf("cannot write report: %v", err)
+	}
+	return nil
+}
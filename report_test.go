@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	result := Result{ExitCode: 124, Reason: ReasonOutput, Matched: "panic: boom", Error: errors.New("oops")}
+
+	if err := writeReport(path, []string{"go", "test"}, result); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Report is not valid JSON: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"exit_code":    float64(124),
+		"reason":       "output",
+		"matched_line": "panic: boom",
+		"error":        "oops",
+	}
+	for key, value := range expected {
+		if got[key] != value {
+			t.Errorf("Expected %s=%v, got %v", key, value, got[key])
+		}
+	}
+}
+
+func TestWriteReportUnescaped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	command := []string{"sh", "-c", "echo <done> >&2"}
+	if err := writeReport(path, command, Result{Matched: "a && b"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	for _, expected := range []string{`"echo <done> >&2"`, `"matched_line": "a && b"`} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("Expected the report to contain %s, got %s", expected, data)
+		}
+	}
+}
+
+func TestWriteReportError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "report.json")
+	if err := writeReport(path, []string{"true"}, Result{}); err == nil {
+		t.Errorf("Expected error writing to a missing directory")
+	}
+}
+
+func TestRunTimeoutReport(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	path := filepath.Join(t.TempDir(), "report.json")
+	config := Config{
+		SignalName: "TERM",
+		Report:     path,
+		Stdout:     &stdout,
+		Stderr:     &stderr,
+	}
+
+	runTimeout(config, []string{"5s", "sh", "-c", "exit 7"})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+
+	var got jsonReport
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Report is not valid JSON: %v", err)
+	}
+	if got.ExitCode != 7 || got.Reason != ReasonCompleted || len(got.Command) != 3 {
+		t.Errorf("Unexpected report: %+v", got)
+	}
+}
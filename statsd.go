@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statsdTimeout bounds resolving and sending to the --statsd server
+const statsdTimeout = time.Second
+
+// parseStatsDAddr checks the --statsd HOST:PORT address
+func parseStatsDAddr(config Config) error {
+	if config.StatsD == "" {
+		return nil
+	}
+	host, port, err := net.SplitHostPort(config.StatsD)
+	if err != nil || host == "" {
+		return fmt.Errorf("invalid statsd address '%s'", config.StatsD)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid statsd address '%s'", config.StatsD)
+	}
+	return nil
+}
+
+// statsdPayload renders result as DogStatsD lines tagged with labels: the
+// wall time, a count of timeouts by reason, the exit status and peak RSS
+func statsdPayload(result Result, labels []metricLabel) string {
+	var tags []string
+	for _, l := range labels {
+		tags = append(tags, statsdTag(l.name)+":"+statsdTag(l.value))
+	}
+	tagged := func(extra ...string) string {
+		all := append(append([]string{}, tags...), extra...)
+		if len(all) == 0 {
+			return ""
+		}
+		return "|#" + strings.Join(all, ",")
+	}
+
+	ms := strconv.FormatFloat(float64(result.Elapsed)/float64(time.Millisecond), 'f', -1, 64)
+	lines := []string{
+		"timeout.duration:" + ms + "|ms" + tagged(),
+		"timeout.exit_code:" + strconv.Itoa(result.ExitCode) + "|g" + tagged(),
+	}
+	if stoppedByTimeout(result.Reason) {
+		lines = append(lines, "timeout.timeouts:1|c"+tagged("reason:"+result.Reason))
+	}
+	if result.MaxRSS > 0 {
+		lines = append(lines, "timeout.max_rss_bytes:"+strconv.FormatInt(result.MaxRSS, 10)+"|g"+tagged())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// statsdTag replaces the characters that delimit DogStatsD tags
+var statsdTag = strings.NewReplacer("|", "_", ",", "_", "#", "_", "\n", "_", ":", "_").Replace
+
+// sendStatsD sends payload to addr in a single UDP datagram. Delivery is
+// not confirmed, as usual for StatsD.
+func sendStatsD(addr, payload string) error {
+	conn, err := net.DialTimeout("udp", addr, statsdTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(statsdTimeout))
+	_, err = conn.Write([]byte(payload))
+	return err
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseStatsDAddr(t *testing.T) {
+	tests := []struct {
+		addr     string
+		hasError bool
+	}{
+		{"", false},
+		{"localhost:8125", false},
+		{"127.0.0.1:8125", false},
+		{"[::1]:8125", false},
+		{"localhost", true},
+		{":8125", true},
+		{"localhost:statsd", true},
+		{"localhost:0", true},
+		{"localhost:70000", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			err := parseStatsDAddr(Config{StatsD: tt.addr})
+			if tt.hasError && err == nil {
+				t.Errorf("Expected error for %q", tt.addr)
+			}
+			if !tt.hasError && err != nil {
+				t.Errorf("Unexpected error for %q: %v", tt.addr, err)
+			}
+		})
+	}
+}
+
+func TestStatsDPayload(t *testing.T) {
+	tests := []struct {
+		name     string
+		result   Result
+		labels   []metricLabel
+		expected string
+	}{
+		{
+			"completed",
+			Result{ExitCode: 0, Reason: ReasonCompleted, Elapsed: 1500 * time.Millisecond},
+			nil,
+			"timeout.duration:1500|ms\ntimeout.exit_code:0|g",
+		},
+		{
+			"timeout with tags",
+			Result{ExitCode: 124, Reason: ReasonTimeout, Elapsed: 2*time.Second + 250*time.Microsecond, MaxRSS: 4096},
+			[]metricLabel{{"job", "nightly"}, {"team", "a,b|c"}},
+			"timeout.duration:2000.25|ms|#job:nightly,team:a_b_c\n" +
+				"timeout.exit_code:124|g|#job:nightly,team:a_b_c\n" +
+				"timeout.timeouts:1|c|#job:nightly,team:a_b_c,reason:timeout\n" +
+				"timeout.max_rss_bytes:4096|g|#job:nightly,team:a_b_c",
+		},
+		{
+			"output limit",
+			Result{ExitCode: 124, Reason: ReasonOutputLimit},
+			nil,
+			"timeout.duration:0|ms\ntimeout.exit_code:124|g\ntimeout.timeouts:1|c|#reason:output-limit",
+		},
+		{
+			"interrupted",
+			Result{ExitCode: 130, Reason: ReasonSignal},
+			nil,
+			"timeout.duration:0|ms\ntimeout.exit_code:130|g",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := statsdPayload(tt.result, tt.labels); got != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+		})
+	}
+}
+
+// listenStatsD returns a UDP socket standing in for a StatsD server
+func listenStatsD(t *testing.T) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readStatsD returns the next datagram received by conn
+func readStatsD(t *testing.T, conn net.PacketConn) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 65536)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Expected a StatsD packet: %v", err)
+	}
+	return string(buf[:n])
+}
+
+func TestRunTimeoutStatsD(t *testing.T) {
+	server := listenStatsD(t)
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName:    "TERM",
+		StatsD:        server.LocalAddr().String(),
+		MetricsLabels: []string{"job=nightly"},
+		Stdout:        &stdout,
+		Stderr:        &stderr,
+	}
+	clock := newFakeClock()
+	proc := newFakeProcess(exitOn(-1, syscall.SIGTERM))
+
+	results := runFake(config, clock, proc, []string{"10s", "server"})
+	clock.WaitForTimers(t, 1)
+	clock.Advance(10 * time.Second)
+	waitResult(t, results)
+
+	expected := "timeout.duration:10000|ms|#job:nightly\n" +
+		"timeout.exit_code:124|g|#job:nightly\n" +
+		"timeout.timeouts:1|c|#job:nightly,reason:timeout"
+	if got := readStatsD(t, server); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestRunTimeoutStatsDMaxRSS(t *testing.T) {
+	server := listenStatsD(t)
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", StatsD: server.LocalAddr().String(), Stdout: &stdout, Stderr: &stderr}
+
+	result := runTimeout(config, []string{"5s", "sh", "-c", "exit 3"})
+
+	if result.ExitCode != 3 {
+		t.Errorf("Expected exit code 3, got %d", result.ExitCode)
+	}
+	if result.MaxRSS <= 0 {
+		t.Errorf("Expected the command's peak RSS, got %d", result.MaxRSS)
+	}
+	payload := readStatsD(t, server)
+	if !strings.Contains(payload, "timeout.exit_code:3|g") || !strings.Contains(payload, "timeout.max_rss_bytes:") {
+		t.Errorf("Expected the exit code and max RSS gauges, got:\n%s", payload)
+	}
+}
+
+func TestRunTimeoutStatsDUnreachable(t *testing.T) {
+	// Nothing listens on the socket once it is closed
+	server := listenStatsD(t)
+	addr := server.LocalAddr().String()
+	server.Close()
+
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", StatsD: addr, Stdout: &stdout, Stderr: &stderr}
+
+	result := runTimeout(config, []string{"5s", "true"})
+
+	if result.ExitCode != 0 {
+		t.Errorf("StatsD should never affect the exit code, got %d", result.ExitCode)
+	}
+	if stderr.String() != "" {
+		t.Errorf("Expected no output, got %q", stderr.String())
+	}
+}
+
+func TestRunTimeoutStatsDInvalid(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", StatsD: "localhost", Stdout: &stdout, Stderr: &stderr}
+
+	result := runTimeout(config, []string{"5s", "true"})
+
+	if result.ExitCode != 125 {
+		t.Errorf("Expected exit code 125, got %d", result.ExitCode)
+	}
+	if !strings.Contains(stderr.String(), "invalid statsd address 'localhost'") {
+		t.Errorf("Expected an error message, got %q", stderr.String())
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Modes accepted by --stdin besides a file name
+const (
+	StdinInherit = "inherit"
+	StdinNull    = "null"
+	StdinClose   = "close"
+)
+
+// openStdin returns the stdin to give the command for --stdin, and a
+// function releasing it once the command has exited
+func openStdin(config Config) (io.Reader, func(), error) {
+	switch config.StdinMode {
+	case "", StdinInherit:
+		return config.Stdin, func() {}, nil
+	case StdinNull:
+		f, err := os.Open(os.DevNull)
+		if err != nil {
+			return nil, nil, err
+		}
+		return f, func() { f.Close() }, nil
+	case StdinClose:
+		// os/exec passes a closed file's invalid descriptor on as a closed
+		// fd 0, so the command's reads fail with EBADF
+		f, err := os.Open(os.DevNull)
+		if err != nil {
+			return nil, nil, err
+		}
+		f.Close()
+		return f, func() {}, nil
+	}
+
+	f, err := os.Open(config.StdinMode)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot open stdin: %v", err)
+	}
+	return f, func() { f.Close() }, nil
+}
+
+// watchesStdin reports whether --stdin-timeout can watch stdin, which it
+// only does for a terminal
+func watchesStdin(stdin io.Reader) bool {
+	f, ok := stdin.(*os.File)
+	return ok && f != nil && isTerminal(f)
+}
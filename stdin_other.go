@@ -0,0 +1,24 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// backgroundAttr is not needed where --stdin-timeout is unsupported
+func backgroundAttr() *syscall.SysProcAttr {
+	return nil
+}
+
+// processStopped is never true where it cannot be detected
+func processStopped(pid int) bool {
+	return false
+}
+
+// isTerminal is never true where terminals are not detected, which
+// disables --stdin-timeout
+func isTerminal(f *os.File) bool {
+	return false
+}
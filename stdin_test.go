@@ -0,0 +1,178 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestOpenStdin(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.txt")
+	if err := os.WriteFile(input, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		mode     string
+		expected string
+		hasError bool
+	}{
+		{"null", StdinNull, "", false},
+		{"file", input, "hello\n", false},
+		{"missing file", filepath.Join(dir, "missing"), "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdin, release, err := openStdin(Config{StdinMode: tt.mode})
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("Expected error for %q", tt.mode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer release()
+
+			data, err := io.ReadAll(stdin)
+			if err != nil {
+				t.Fatalf("Unexpected read error: %v", err)
+			}
+			if string(data) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, string(data))
+			}
+		})
+	}
+}
+
+func TestOpenStdinInherit(t *testing.T) {
+	in := strings.NewReader("from parent")
+	for _, mode := range []string{"", StdinInherit} {
+		stdin, release, err := openStdin(Config{StdinMode: mode, Stdin: in})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		release()
+		if stdin != in {
+			t.Errorf("Expected mode %q to pass on the parent's stdin", mode)
+		}
+	}
+}
+
+func TestRunTimeoutStdin(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(input, []byte("from file\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		mode     string
+		expected string
+	}{
+		{"file", input, "from file\n"},
+		{"null", StdinNull, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr SafeBuffer
+			config := Config{
+				SignalName: "TERM",
+				StdinMode:  tt.mode,
+				Stdin:      strings.NewReader("from parent\n"),
+				Stdout:     &stdout,
+				Stderr:     &stderr,
+			}
+
+			result := runTimeout(config, []string{"5s", "cat"})
+
+			if result.ExitCode != 0 {
+				t.Errorf("Expected exit code 0, got %d (%s)", result.ExitCode, stderr.String())
+			}
+			if stdout.String() != tt.expected {
+				t.Errorf("Expected output %q, got %q", tt.expected, stdout.String())
+			}
+		})
+	}
+}
+
+func TestRunTimeoutStdinClose(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName: "TERM",
+		StdinMode:  StdinClose,
+		Stdin:      strings.NewReader("from parent\n"),
+		Stdout:     &stdout,
+		Stderr:     &stderr,
+	}
+
+	result := runTimeout(config, []string{"5s", "cat"})
+
+	// Unlike with null, reading the closed stdin fails rather than ending
+	if result.ExitCode == 0 {
+		t.Errorf("Expected cat to fail reading a closed stdin")
+	}
+	if !strings.Contains(stderr.String(), "Bad file descriptor") {
+		t.Errorf("Expected an EBADF error from cat, got %q", stderr.String())
+	}
+}
+
+func TestRunTimeoutStdinInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{"missing file", Config{StdinMode: filepath.Join(t.TempDir(), "missing")}},
+		{"invalid stdin timeout", Config{StdinTimeout: "soon"}},
+		{"stdin timeout with pty", Config{StdinTimeout: "5s", Pty: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr SafeBuffer
+			tt.config.SignalName = "TERM"
+			tt.config.Stdout = &stdout
+			tt.config.Stderr = &stderr
+
+			result := runTimeout(tt.config, []string{"5s", "true"})
+
+			if result.ExitCode != 125 {
+				t.Errorf("Expected exit code 125, got %d", result.ExitCode)
+			}
+			if !strings.Contains(stderr.String(), "timeout:") {
+				t.Errorf("Expected an error message, got %q", stderr.String())
+			}
+		})
+	}
+}
+
+func TestRunTimeoutContinuesStoppedCommand(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", Stdout: &stdout, Stderr: &stderr}
+	clock := newFakeClock()
+	proc := newFakeProcess(exitOn(-1, syscall.SIGCONT))
+
+	results := runFake(config, clock, proc, []string{"1s", "server"})
+	clock.WaitForTimers(t, 1)
+	clock.Advance(time.Second)
+	result := waitResult(t, results)
+
+	proc.mu.Lock()
+	signals := proc.signals
+	proc.mu.Unlock()
+	if len(signals) != 2 || signals[0] != syscall.SIGTERM || signals[1] != syscall.SIGCONT {
+		t.Errorf("Expected TERM followed by CONT, got %v", signals)
+	}
+	if strings.Join(result.Signals, ",") != "TERM" {
+		t.Errorf("Expected only TERM to be reported, got %v", result.Signals)
+	}
+}
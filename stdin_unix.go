@@ -0,0 +1,39 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"encoding/binary"
+	"syscall"
+	"unsafe"
+)
+
+// cldStopped is the siginfo code of a child stopped by a signal
+const cldStopped = 5
+
+// pidType selects a single process in waitid
+const pidType = 1
+
+// backgroundAttr puts the command in its own process group, in the
+// background of the terminal, so that reading from it stops the command
+// with SIGTTIN
+func backgroundAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
+
+// processStopped reports whether the child pid is stopped, without reaping
+// it or clearing its state
+func processStopped(pid int) bool {
+	var info [128]byte
+	_, _, errno := syscall.Syscall6(syscall.SYS_WAITID, pidType, uintptr(pid), uintptr(unsafe.Pointer(&info[0])),
+		syscall.WSTOPPED|syscall.WNOHANG|syscall.WNOWAIT, 0, 0)
+	if errno != 0 {
+		return false
+	}
+
+	// siginfo starts with si_signo, si_errno and si_code; it is left zeroed
+	// when no child has changed state
+	signo := int32(binary.NativeEndian.Uint32(info[0:]))
+	code := int32(binary.NativeEndian.Uint32(info[8:]))
+	return signo == int32(syscall.SIGCHLD) && code == cldStopped
+}
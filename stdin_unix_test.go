@@ -0,0 +1,32 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestProcessStopped(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	if processStopped(cmd.Process.Pid) {
+		t.Errorf("Running process should not be reported as stopped")
+	}
+
+	cmd.Process.Signal(syscall.SIGSTOP)
+	deadline := time.Now().Add(5 * time.Second)
+	for !processStopped(cmd.Process.Pid) {
+		if time.Now().After(deadline) {
+			t.Fatal("Stopped process was never reported as stopped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// stepsCommand is the operand that selects the step runner
+const stepsCommand = "run-steps"
+
+// stepFile is the document read by run-steps
+type stepFile struct {
+	// Timeout is the total budget shared by all steps
+	Timeout stepDuration `json:"timeout"`
+	Steps   []step       `json:"steps"`
+}
+
+// step is one command of a run-steps file. Signal and KillAfter override
+// the command line options for this step only.
+type step struct {
+	Name            string       `json:"name"`
+	Argv            []string     `json:"argv"`
+	Timeout         stepDuration `json:"timeout"`
+	Signal          string       `json:"signal"`
+	KillAfter       stepDuration `json:"kill_after"`
+	ContinueOnError bool         `json:"continue_on_error"`
+}
+
+// stepDuration is a DURATION string or a number of seconds
+type stepDuration string
+
+func (d *stepDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*d = stepDuration(s)
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var n json.Number
+	if err := dec.Decode(&n); err != nil {
+		return fmt.Errorf("duration must be a string or a number of seconds")
+	}
+	*d = stepDuration(n.String())
+	return nil
+}
+
+// parseStepFile reads a run-steps file. A file starting with '{' is JSON,
+// anything else the YAML subset read by parseStepYAML.
+func parseStepFile(r io.Reader) (*stepFile, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var sf *stepFile
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		sf = &stepFile{}
+		err = dec.Decode(sf)
+	} else {
+		sf, err = parseStepYAML(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sf.Steps) == 0 {
+		return nil, fmt.Errorf("no steps")
+	}
+	for i := range sf.Steps {
+		st := &sf.Steps[i]
+		if len(st.Argv) == 0 || st.Argv[0] == "" {
+			return nil, fmt.Errorf("step %d has no argv", i+1)
+		}
+		if st.Name == "" {
+			st.Name = strings.Join(st.Argv, " ")
+		}
+	}
+	return sf, nil
+}
+
+// parseStepYAML parses the subset of YAML used by run-steps files: a
+// top-level timeout and a block list of steps, each a mapping of plain or
+// quoted scalars. argv is a flow list ([make, test]) or a block list.
+func parseStepYAML(r io.Reader) (*stepFile, error) {
+	var (
+		sf         stepFile
+		top        = make(map[string]bool)
+		inSteps    bool
+		st         *step
+		seen       map[string]bool
+		itemIndent = -1 // column of the steps' "-"
+		keyIndent  int  // column of the current step's keys, -1 until known
+		inArgv     bool // reading argv as a block list
+	)
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		text := strings.TrimRight(stripComment(scanner.Text()), " \t")
+		line := strings.TrimLeft(text, " ")
+		if line == "" || (text == "---" && len(top) == 0) {
+			continue
+		}
+		if strings.HasPrefix(line, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", lineNo)
+		}
+		indent := len(text) - len(line)
+		item, isItem := cutListItem(line)
+
+		switch {
+		case indent == 0 && !isItem:
+			inSteps, st, inArgv = false, nil, false
+			key, value, err := cutYAMLKey(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			if top[key] {
+				return nil, fmt.Errorf("line %d: duplicate key '%s'", lineNo, key)
+			}
+			top[key] = true
+			switch key {
+			case "timeout":
+				s, err := parseYAMLScalar(value)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", lineNo, err)
+				}
+				sf.Timeout = stepDuration(s)
+			case "steps":
+				if value != "" {
+					return nil, fmt.Errorf("line %d: steps must be a block list", lineNo)
+				}
+				inSteps = true
+			default:
+				return nil, fmt.Errorf("line %d: unknown key '%s'", lineNo, key)
+			}
+
+		case !inSteps:
+			return nil, fmt.Errorf("line %d: unexpected indentation", lineNo)
+
+		case isItem && inArgv && indent >= keyIndent:
+			s, err := parseYAMLScalar(item)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			st.Argv = append(st.Argv, s)
+
+		case isItem:
+			if itemIndent < 0 {
+				itemIndent = indent
+			}
+			if indent != itemIndent {
+				return nil, fmt.Errorf("line %d: unexpected indentation", lineNo)
+			}
+			sf.Steps = append(sf.Steps, step{})
+			st = &sf.Steps[len(sf.Steps)-1]
+			seen = make(map[string]bool)
+			inArgv = false
+			keyIndent = -1
+			if item == "" {
+				continue
+			}
+			// The rest of the line is the step's first key
+			keyIndent = indent + len(line) - len(item)
+			line, indent = item, keyIndent
+			fallthrough
+
+		default:
+			if st == nil || (keyIndent < 0 && indent <= itemIndent) || (keyIndent >= 0 && indent != keyIndent) {
+				return nil, fmt.Errorf("line %d: unexpected indentation", lineNo)
+			}
+			keyIndent = indent
+			key, value, err := cutYAMLKey(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			if seen[key] {
+				return nil, fmt.Errorf("line %d: duplicate key '%s'", lineNo, key)
+			}
+			seen[key] = true
+			if inArgv, err = setStepValue(st, key, value); err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return &sf, nil
+}
+
+// setStepValue sets the field of st named key. It reports whether a block
+// list of argv items follows.
+func setStepValue(st *step, key, value string) (bool, error) {
+	if key == "argv" {
+		if value == "" {
+			return true, nil
+		}
+		if !strings.HasPrefix(value, "[") {
+			return false, fmt.Errorf("argv must be a list")
+		}
+		argv, err := parseYAMLFlowList(value)
+		st.Argv = argv
+		return false, err
+	}
+
+	s, err := parseYAMLScalar(value)
+	if err != nil {
+		return false, err
+	}
+	switch key {
+	case "name":
+		st.Name = s
+	case "timeout":
+		st.Timeout = stepDuration(s)
+	case "signal":
+		st.Signal = s
+	case "kill_after":
+		st.KillAfter = stepDuration(s)
+	case "continue_on_error":
+		switch s {
+		case "true":
+			st.ContinueOnError = true
+		case "false":
+			st.ContinueOnError = false
+		default:
+			return false, fmt.Errorf("continue_on_error must be true or false")
+		}
+	default:
+		return false, fmt.Errorf("unknown key '%s'", key)
+	}
+	return false, nil
+}
+
+// cutListItem reports whether line is a block list item and returns the
+// text after its "-"
+func cutListItem(line string) (string, bool) {
+	if line == "-" {
+		return "", true
+	}
+	if rest, ok := strings.CutPrefix(line, "- "); ok {
+		return strings.TrimLeft(rest, " "), true
+	}
+	return "", false
+}
+
+// cutYAMLKey splits a "key: value" line
+func cutYAMLKey(line string) (string, string, error) {
+	key, value, ok := strings.Cut(line, ":")
+	if !ok || key == "" || strings.ContainsAny(key, " \t\"'") || (value != "" && value[0] != ' ') {
+		return "", "", fmt.Errorf("expected key: value")
+	}
+	return key, strings.TrimSpace(value), nil
+}
+
+// parseYAMLScalar parses a plain or quoted YAML scalar
+func parseYAMLScalar(s string) (string, error) {
+	switch {
+	case s == "":
+		return "", fmt.Errorf("missing value")
+	case s[0] == '"' || s[0] == '\'':
+		value, tail, err := cutString(s)
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(tail) != "" {
+			return "", fmt.Errorf("unexpected text after string")
+		}
+		return value, nil
+	case strings.IndexByte("[]{}|>&*!%@`", s[0]) >= 0:
+		return "", fmt.Errorf("unsupported value %s", s)
+	}
+	return s, nil
+}
+
+// parseYAMLFlowList parses a single-line flow list of scalars
+func parseYAMLFlowList(s string) ([]string, error) {
+	if !strings.HasSuffix(s, "]") {
+		return nil, fmt.Errorf("unterminated list")
+	}
+	values := []string{}
+	rest := strings.TrimSpace(s[1 : len(s)-1])
+	for rest != "" {
+		var item string
+		if rest[0] == '"' || rest[0] == '\'' {
+			value, tail, err := cutString(rest)
+			if err != nil {
+				return nil, err
+			}
+			item = value
+			tail = strings.TrimSpace(tail)
+			if tail != "" {
+				var ok bool
+				if tail, ok = strings.CutPrefix(tail, ","); !ok {
+					return nil, fmt.Errorf("expected ',' in list")
+				}
+			}
+			rest = tail
+		} else {
+			var err error
+			item, rest, _ = strings.Cut(rest, ",")
+			if item, err = parseYAMLScalar(strings.TrimSpace(item)); err != nil {
+				return nil, err
+			}
+		}
+		values = append(values, item)
+		rest = strings.TrimSpace(rest)
+	}
+	return values, nil
+}
+
+// runSteps runs the steps of the file named by args one after the other.
+// Each step's timeout is cut short by whatever remains of the file's total
+// timeout. The exit status is that of the first step that stopped the run.
+func runSteps(config Config, args []string) Result {
+	if len(args) > 1 {
+		fmt.Fprintf(config.Stderr, "timeout: extra operand '%s'\n", args[1])
+		fmt.Fprintf(config.Stderr, "Try 'timeout --help' for more information.\n")
+		return Result{ExitCode: 125}
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		fmt.Fprintf(config.Stderr, "timeout: cannot read steps: %v\n", err)
+		return Result{ExitCode: 125}
+	}
+	sf, err := parseStepFile(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(config.Stderr, "timeout: %s: %v\n", args[0], err)
+		return Result{ExitCode: 125}
+	}
+
+	scale, err := parseScale(config.Scale)
+	if err != nil {
+		fmt.Fprintf(config.Stderr, "timeout: %v\n", err)
+		return Result{ExitCode: 125}
+	}
+
+	// Parse the total budget
+	var budget time.Duration
+	if sf.Timeout != "" {
+		d, err := parseDuration(string(sf.Timeout))
+		if err != nil {
+			fmt.Fprintf(config.Stderr, "timeout: invalid time interval '%s': %v\n", sf.Timeout, err)
+			return Result{ExitCode: 125}
+		}
+		budget = scaleOption(config, "total timeout", d, scale)
+	}
+
+	// Check every step before running the first one
+	executions := make([]*execution, len(sf.Steps))
+	for i, st := range sf.Steps {
+		c := config
+		if st.Signal != "" {
+			c.SignalName = st.Signal
+		}
+		if st.KillAfter != "" {
+			c.KillAfter = string(st.KillAfter)
+		}
+		if c.Logger != nil {
+			c.Logger = c.Logger.With("step", st.Name)
+		}
+		timeout := string(st.Timeout)
+		if timeout == "" {
+			timeout = "0"
+		}
+
+		e, err := newExecution(c, timeout, st.Argv[0])
+		if err != nil {
+			fmt.Fprintf(config.Stderr, "timeout: step '%s': %v\n", st.Name, err)
+			return Result{ExitCode: 125}
+		}
+		executions[i] = e
+	}
+
+	files, err := openOutputFiles(config)
+	if err != nil {
+		fmt.Fprintf(config.Stderr, "timeout: %v\n", err)
+		return Result{ExitCode: 125}
+	}
+	for _, e := range executions {
+		e.stdout, e.stderr = files.writers(config.Stdout, config.Stderr)
+	}
+
+	start := config.Clock.Now()
+	result := Result{
+		Reason:  ReasonCompleted,
+		Command: []string{stepsCommand, args[0]},
+	}
+	for i, st := range sf.Steps {
+		skipped := Result{Name: st.Name, Command: st.Argv, Reason: ReasonSkipped}
+		if result.ExitCode != 0 {
+			result.Commands = append(result.Commands, skipped)
+			continue
+		}
+
+		e := executions[i]
+		limited := false
+		if budget > 0 {
+			remaining := budget - config.Clock.Now().Sub(start)
+			if remaining <= 0 {
+				result.ExitCode = 124
+				result.Reason = ReasonBudget
+				result.Commands = append(result.Commands, skipped)
+				continue
+			}
+			if e.timeout == 0 || remaining < e.timeout {
+				e.timeout = remaining
+				limited = true
+			}
+		}
+
+		e.log.Info(fmt.Sprintf("running step '%s' with a timeout of %s", st.Name, e.timeout),
+			"event", "step", "timeout", e.timeout)
+		r := e.run(ProcessSpec{Name: st.Argv[0], Args: st.Argv[1:]})
+		r.Name = st.Name
+		if limited && r.Reason == ReasonTimeout {
+			r.Reason = ReasonBudget
+		}
+		result.Commands = append(result.Commands, r)
+		result.MaxRSS = max(result.MaxRSS, r.MaxRSS)
+
+		// continue_on_error tolerates the step failing, not the run being
+		// interrupted or out of time
+		if r.ExitCode != 0 && (!st.ContinueOnError || r.Reason == ReasonSignal || r.Reason == ReasonBudget) {
+			result.ExitCode = r.ExitCode
+			result.Reason = r.Reason
+			result.StdoutTail = r.StdoutTail
+			result.StderrTail = r.StderrTail
+		}
+	}
+	result.Elapsed = config.Clock.Now().Sub(start)
+	result.Limit = budget
+	result.Start = start
+
+	if err := files.Close(); err != nil {
+		fmt.Fprintf(config.Stderr, "timeout: %v\n", err)
+	}
+
+	printSteps(config.Stderr, result.Commands)
+	return finish(config, result.Command, result)
+}
+
+// printSteps writes the summary table of a run-steps run to w
+func printSteps(w io.Writer, results []Result) {
+	if w == nil {
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tRESULT\tEXIT\tELAPSED")
+	for _, r := range results {
+		if r.Reason == ReasonSkipped {
+			fmt.Fprintf(tw, "%s\t%s\t-\t-\n", r.Name, r.Reason)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", r.Name, r.Reason, r.ExitCode, r.Elapsed.Round(time.Millisecond))
+	}
+	tw.Flush()
+}
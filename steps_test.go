@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeSteps writes a run-steps file and returns its path
+func writeSteps(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "steps.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write steps: %v", err)
+	}
+	return path
+}
+
+func TestParseStepFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		steps    int
+		hasError bool
+	}{
+		{"minimal", `{"steps": [{"argv": ["true"]}]}`, 1, false},
+		{"full", `{"timeout": "10m", "steps": [{"name": "build", "argv": ["make"], "timeout": "5m", "signal": "INT", "kill_after": 30, "continue_on_error": true}]}`, 1, false},
+		{"numeric timeout", `{"timeout": 90, "steps": [{"argv": ["a"], "timeout": 1.5}, {"argv": ["b"]}]}`, 2, false},
+
+		{"no steps", `{"steps": []}`, 0, true},
+		{"empty argv", `{"steps": [{"argv": []}]}`, 0, true},
+		{"unknown field", `{"steps": [{"argv": ["true"], "retries": 3}]}`, 0, true},
+		{"invalid timeout type", `{"steps": [{"argv": ["true"], "timeout": true}]}`, 0, true},
+		{"invalid json", `{"steps": [`, 0, true},
+
+		{"yaml minimal", "steps:\n  - argv: [true]\n", 1, false},
+		{"yaml full", "timeout: 10m\nsteps:\n- name: build\n  argv: [make]\n  timeout: 5m\n  signal: INT\n  kill_after: 30\n  continue_on_error: true\n", 1, false},
+		{"yaml block argv", "steps:\n  - argv:\n      - make\n      - test\n  - argv:\n    - b\n", 2, false},
+		{"yaml dash alone", "---\nsteps:\n  -\n    argv: [a]\n", 1, false},
+		{"yaml no steps", "timeout: 1m\n", 0, true},
+		{"yaml unknown key", "steps:\n  - argv: [true]\n    retries: 3\n", 0, true},
+		{"yaml duplicate key", "steps:\n  - argv: [a]\n    argv: [b]\n", 0, true},
+		{"yaml scalar argv", "steps:\n  - argv: make\n", 0, true},
+		{"yaml bad indentation", "steps:\n  - argv: [a]\n      name: a\n", 0, true},
+		{"yaml tab indentation", "steps:\n\t- argv: [a]\n", 0, true},
+		{"yaml invalid bool", "steps:\n  - argv: [a]\n    continue_on_error: yes\n", 0, true},
+		{"yaml nested mapping", "steps:\n  - argv: [a]\n    env:\n      A: 1\n", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sf, err := parseStepFile(strings.NewReader(test.input))
+
+			if test.hasError {
+				if err == nil {
+					t.Errorf("Expected error, but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+
+			if len(sf.Steps) != test.steps {
+				t.Errorf("Expected %d steps, got %d", test.steps, len(sf.Steps))
+			}
+		})
+	}
+}
+
+func TestParseStepFileDefaults(t *testing.T) {
+	sf, err := parseStepFile(strings.NewReader(`{"timeout": 90, "steps": [{"argv": ["make", "test"], "kill_after": 2.5}]}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if sf.Timeout != "90" {
+		t.Errorf("Expected total timeout '90', got %q", sf.Timeout)
+	}
+	if sf.Steps[0].Name != "make test" {
+		t.Errorf("Expected the name to default to the command line, got %q", sf.Steps[0].Name)
+	}
+	if sf.Steps[0].KillAfter != "2.5" {
+		t.Errorf("Expected kill_after '2.5', got %q", sf.Steps[0].KillAfter)
+	}
+}
+
+func TestParseStepFileYAML(t *testing.T) {
+	input := `# build and test
+timeout: 90
+steps:
+  - name: "unit tests"   # quoted
+    argv: [go, test, './...', "a, b"]
+    kill_after: 2.5
+  - argv:
+      - sh
+      - -c
+      - 'echo "#1"'
+    continue_on_error: true
+`
+	sf, err := parseStepFile(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if sf.Timeout != "90" {
+		t.Errorf("Expected total timeout '90', got %q", sf.Timeout)
+	}
+	if len(sf.Steps) != 2 {
+		t.Fatalf("Expected 2 steps, got %d", len(sf.Steps))
+	}
+	first, second := sf.Steps[0], sf.Steps[1]
+	if first.Name != "unit tests" || first.KillAfter != "2.5" {
+		t.Errorf("Expected name 'unit tests' and kill_after '2.5', got %q and %q", first.Name, first.KillAfter)
+	}
+	if strings.Join(first.Argv, "|") != "go|test|./...|a, b" {
+		t.Errorf("Unexpected argv %q", first.Argv)
+	}
+	if strings.Join(second.Argv, "|") != `sh|-c|echo "#1"` || !second.ContinueOnError {
+		t.Errorf("Unexpected second step %+v", second)
+	}
+	if second.Name != `sh -c echo "#1"` {
+		t.Errorf("Expected the name to default to the command line, got %q", second.Name)
+	}
+}
+
+func TestRunSteps(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	path := writeSteps(t, `{"steps": [
+		{"name": "first", "argv": ["echo", "hello"]},
+		{"name": "flaky", "argv": ["sh", "-c", "exit 3"], "continue_on_error": true},
+		{"name": "last", "argv": ["true"]}
+	]}`)
+	config := Config{SignalName: "TERM", Stdout: &stdout, Stderr: &stderr}
+
+	result := runTimeout(config, []string{"run-steps", path})
+
+	if result.ExitCode != 0 {
+		t.Errorf("Expected exit code 0, got %d (stderr: %q)", result.ExitCode, stderr.String())
+	}
+	if len(result.Commands) != 3 || result.Commands[1].ExitCode != 3 {
+		t.Errorf("Expected three steps with the second failing, got %+v", result.Commands)
+	}
+	if !strings.Contains(stdout.String(), "hello") {
+		t.Errorf("Step output should pass through, got %q", stdout.String())
+	}
+	for _, expected := range []string{"STEP", "first", "flaky", "last"} {
+		if !strings.Contains(stderr.String(), expected) {
+			t.Errorf("Summary missing %q: %q", expected, stderr.String())
+		}
+	}
+}
+
+func TestRunStepsFailure(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	path := writeSteps(t, `{"steps": [
+		{"argv": ["sh", "-c", "exit 3"]},
+		{"argv": ["true"]}
+	]}`)
+	config := Config{SignalName: "TERM", Stdout: &stdout, Stderr: &stderr}
+
+	result := runTimeout(config, []string{"run-steps", path})
+
+	if result.ExitCode != 3 {
+		t.Errorf("Expected the failing step's exit code 3, got %d", result.ExitCode)
+	}
+	if result.Commands[1].Reason != ReasonSkipped {
+		t.Errorf("Expected the next step to be skipped, got %q", result.Commands[1].Reason)
+	}
+}
+
+func TestRunStepsTimeouts(t *testing.T) {
+	tests := []struct {
+		name   string
+		steps  string
+		reason string
+	}{
+		{"step timeout", `{"steps": [{"argv": ["sleep", "5"], "timeout": "0.2s"}, {"argv": ["true"]}]}`, ReasonTimeout},
+		{"total budget", `{"timeout": "0.2s", "steps": [{"argv": ["sleep", "5"], "timeout": "10s"}, {"argv": ["true"]}]}`, ReasonBudget},
+		{"budget without step timeout", `{"timeout": 0.2, "steps": [{"argv": ["sleep", "5"]}, {"argv": ["true"]}]}`, ReasonBudget},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr SafeBuffer
+			config := Config{SignalName: "TERM", Stdout: &stdout, Stderr: &stderr}
+
+			result := runTimeout(config, []string{"run-steps", writeSteps(t, test.steps)})
+
+			if result.ExitCode != 124 || result.Reason != test.reason {
+				t.Errorf("Expected exit code 124 with reason %q, got %d %q", test.reason, result.ExitCode, result.Reason)
+			}
+			if result.Commands[1].Reason != ReasonSkipped {
+				t.Errorf("Expected the next step to be skipped, got %q", result.Commands[1].Reason)
+			}
+		})
+	}
+}
+
+func TestRunStepsReport(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	report := filepath.Join(t.TempDir(), "report.json")
+	path := writeSteps(t, `{"steps": [{"name": "build", "argv": ["true"]}, {"name": "test", "argv": ["false"]}]}`)
+	config := Config{SignalName: "TERM", Report: report, Stdout: &stdout, Stderr: &stderr}
+
+	runTimeout(config, []string{"run-steps", path})
+
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	var r jsonReport
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatalf("Invalid report: %v", err)
+	}
+	if r.ExitCode != 1 || len(r.Commands) != 2 {
+		t.Fatalf("Expected exit code 1 with 2 steps, got %d with %d", r.ExitCode, len(r.Commands))
+	}
+	if r.Commands[0].Name != "build" || r.Commands[1].Name != "test" {
+		t.Errorf("Expected step names in the report, got %q and %q", r.Commands[0].Name, r.Commands[1].Name)
+	}
+}
+
+func TestRunStepsInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps string
+		extra []string
+	}{
+		{"invalid step signal", `{"steps": [{"argv": ["true"], "signal": "BOGUS"}]}`, nil},
+		{"invalid step timeout", `{"steps": [{"argv": ["true"], "timeout": "soon"}]}`, nil},
+		{"invalid total timeout", `{"timeout": "soon", "steps": [{"argv": ["true"]}]}`, nil},
+		{"invalid file", `steps:`, nil},
+		{"extra operand", `{"steps": [{"argv": ["true"]}]}`, []string{"extra"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr SafeBuffer
+			config := Config{SignalName: "TERM", Stdout: &stdout, Stderr: &stderr}
+			args := append([]string{"run-steps", writeSteps(t, test.steps)}, test.extra...)
+
+			result := runTimeout(config, args)
+
+			if result.ExitCode != 125 {
+				t.Errorf("Expected exit code 125, got %d", result.ExitCode)
+			}
+		})
+	}
+}
+
+func TestRunStepsMissingFile(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", Stdout: &stdout, Stderr: &stderr}
+
+	result := runTimeout(config, []string{"run-steps", filepath.Join(t.TempDir(), "missing.json")})
+
+	if result.ExitCode != 125 {
+		t.Errorf("Expected exit code 125, got %d", result.ExitCode)
+	}
+	if !strings.Contains(stderr.String(), "cannot read steps") {
+		t.Errorf("Expected a read error, got %q", stderr.String())
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Default sockets of journald and of the local syslog daemon
+const defaultJournalSocket = "/run/systemd/journal/socket"
+
+var defaultSyslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// syslogFacilities maps --syslog facility names to their codes
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// Syslog severities
+const (
+	severityErr     = 3
+	severityWarning = 4
+	severityInfo    = 6
+)
+
+// parseSyslogFacility parses the --syslog facility
+func parseSyslogFacility(config Config) (int, error) {
+	facility, ok := syslogFacilities[strings.ToLower(config.Syslog)]
+	if !ok {
+		return 0, fmt.Errorf("invalid syslog facility '%s'", config.Syslog)
+	}
+	return facility, nil
+}
+
+// syslogHandler sends timeout's events to journald with structured fields,
+// or else to the local syslog daemon. Besides the events logged at info
+// level and above, it records when the command started and how it ended.
+type syslogHandler struct {
+	conn     net.Conn
+	journal  bool
+	facility int
+	attrs    []slog.Attr
+}
+
+// openSyslog connects to journald when its socket exists, and otherwise to
+// the first syslog socket that accepts the connection
+func openSyslog(config Config, facility int) (*syslogHandler, error) {
+	journal := config.JournalSocket
+	if journal == "" {
+		journal = defaultJournalSocket
+	}
+	if _, err := os.Stat(journal); err == nil {
+		conn, err := net.Dial("unixgram", journal)
+		if err != nil {
+			return nil, fmt.Errorf("cannot connect to journald: %v", err)
+		}
+		return &syslogHandler{conn: conn, journal: true, facility: facility}, nil
+	}
+
+	sockets := defaultSyslogSockets
+	if config.SyslogSocket != "" {
+		sockets = []string{config.SyslogSocket}
+	}
+	var lastErr error
+	for _, path := range sockets {
+		conn, err := net.Dial("unixgram", path)
+		if err == nil {
+			return &syslogHandler{conn: conn, facility: facility}, nil
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("cannot connect to syslog: %v", lastErr)
+}
+
+// Close closes the connection to the daemon
+func (h *syslogHandler) Close() error {
+	return h.conn.Close()
+}
+
+func (h *syslogHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *syslogHandler) Handle(_ context.Context, r slog.Record) error {
+	var attrs []slog.Attr
+	attrs = append(attrs, h.attrs...)
+	event := ""
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == "event" {
+			event = a.Value.String()
+		}
+		attrs = append(attrs, a)
+		return true
+	})
+	if r.Level < slog.LevelInfo && event != "start" && event != "end" {
+		return nil
+	}
+
+	severity := severityInfo
+	switch {
+	case r.Level >= slog.LevelError:
+		severity = severityErr
+	case r.Level >= slog.LevelWarn:
+		severity = severityWarning
+	}
+
+	var msg []byte
+	if h.journal {
+		msg = h.journalEntry(r.Message, severity, attrs)
+	} else {
+		msg = fmt.Appendf(nil, "<%d>%s timeout[%d]: %s", h.facility*8+severity, r.Time.Format(time.Stamp), os.Getpid(), r.Message)
+	}
+	_, err := h.conn.Write(msg)
+	return err
+}
+
+// journalEntry encodes an entry in the journald native protocol, with each
+// attribute as a TIMEOUT_NAME field
+func (h *syslogHandler) journalEntry(message string, severity int, attrs []slog.Attr) []byte {
+	var b bytes.Buffer
+	field := func(name, value string) {
+		if !strings.Contains(value, "\n") {
+			fmt.Fprintf(&b, "%s=%s\n", name, value)
+			return
+		}
+		// Multi-line values are length-prefixed
+		b.WriteString(name + "\n")
+		binary.Write(&b, binary.LittleEndian, uint64(len(value)))
+		b.WriteString(value + "\n")
+	}
+
+	field("MESSAGE", message)
+	field("PRIORITY", fmt.Sprint(severity))
+	field("SYSLOG_FACILITY", fmt.Sprint(h.facility))
+	field("SYSLOG_IDENTIFIER", "timeout")
+	field("SYSLOG_PID", fmt.Sprint(os.Getpid()))
+	for _, a := range attrs {
+		field(journalFieldName(a.Key), journalValue(a.Value))
+	}
+	return b.Bytes()
+}
+
+// journalFieldName turns an attribute key into a journald field name
+func journalFieldName(key string) string {
+	name := []byte("TIMEOUT_" + strings.ToUpper(key))
+	for i, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			name[i] = '_'
+		}
+	}
+	return string(name)
+}
+
+// journalValue formats an attribute value, joining a command line with
+// spaces
+func journalValue(v slog.Value) string {
+	if args, ok := v.Any().([]string); ok {
+		return strings.Join(args, " ")
+	}
+	return v.String()
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.attrs = append(append([]slog.Attr{}, h.attrs...), attrs...)
+	return &c
+}
+
+func (h *syslogHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// teeHandler passes each record to every handler that is enabled for it
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var first error
+	for _, h := range t {
+		if h.Enabled(ctx, r.Level) {
+			if err := h.Handle(ctx, r.Clone()); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := make(teeHandler, len(t))
+	for i, h := range t {
+		c[i] = h.WithAttrs(attrs)
+	}
+	return c
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	c := make(teeHandler, len(t))
+	for i, h := range t {
+		c[i] = h.WithGroup(name)
+	}
+	return c
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// listenUnixgram returns a datagram socket standing in for journald or the
+// syslog daemon
+func listenUnixgram(t *testing.T) (*net.UnixConn, string) {
+	path := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unixgram sockets are not available: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, path
+}
+
+// readDatagrams returns the datagrams already sent to conn
+func readDatagrams(conn *net.UnixConn) []string {
+	var messages []string
+	buf := make([]byte, 65536)
+	for {
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, err := conn.Read(buf)
+		if err != nil {
+			return messages
+		}
+		messages = append(messages, string(buf[:n]))
+	}
+}
+
+// journalFields parses a journald native protocol entry without binary
+// fields
+func journalFields(entry string) map[string]string {
+	fields := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSuffix(entry, "\n"), "\n") {
+		name, value, _ := strings.Cut(line, "=")
+		fields[name] = value
+	}
+	return fields
+}
+
+func TestParseSyslogFacility(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected int
+		hasError bool
+	}{
+		{"user", 1, false},
+		{"daemon", 3, false},
+		{"cron", 9, false},
+		{"LOCAL0", 16, false},
+		{"local7", 23, false},
+		{"local8", 0, true},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			facility, err := parseSyslogFacility(Config{Syslog: tt.name})
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("Expected error for %q", tt.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if facility != tt.expected {
+				t.Errorf("Expected facility %d, got %d", tt.expected, facility)
+			}
+		})
+	}
+}
+
+func TestRunTimeoutSyslog(t *testing.T) {
+	server, path := listenUnixgram(t)
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName:    "TERM",
+		KillAfter:     "1s",
+		Syslog:        "user",
+		SyslogSocket:  path,
+		JournalSocket: filepath.Join(t.TempDir(), "no-journal"),
+		Stdout:        &stdout,
+		Stderr:        &stderr,
+	}
+	clock := newFakeClock()
+	proc := newFakeProcess(exitOn(-1, syscall.SIGKILL))
+
+	results := runFake(config, clock, proc, []string{"10s", "server"})
+	clock.WaitForTimers(t, 1)
+	clock.Advance(10 * time.Second)
+	clock.WaitForTimers(t, 1)
+	clock.Advance(time.Second)
+	waitResult(t, results)
+
+	prefix := fmt.Sprintf("timeout[%d]: ", os.Getpid())
+	expected := []string{
+		"<14>" + prefix + "started command 'server' with pid 4242",
+		"<14>" + prefix + "sending signal TERM to command 'server'",
+		"<14>" + prefix + "sending signal KILL to command 'server'",
+		"<14>" + prefix + "command 'server' ended (timeout) with status 124",
+	}
+	messages := readDatagrams(server)
+	if len(messages) != len(expected) {
+		t.Fatalf("Expected %d messages, got %q", len(expected), messages)
+	}
+	for i, msg := range messages {
+		// Drop the timestamp after the priority
+		pri, rest, _ := strings.Cut(msg, ">")
+		if got := pri + ">" + rest[len(time.Stamp)+1:]; got != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], msg)
+		}
+	}
+	if stderr.String() != "" {
+		t.Errorf("Expected the default stderr output to be unchanged, got %q", stderr.String())
+	}
+}
+
+func TestRunTimeoutJournald(t *testing.T) {
+	server, path := listenUnixgram(t)
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", Syslog: "cron", JournalSocket: path, Stdout: &stdout, Stderr: &stderr}
+	clock := newFakeClock()
+	proc := newFakeProcess(exitOn(-1, syscall.SIGTERM))
+
+	results := runFake(config, clock, proc, []string{"10s", "backup", "--full"})
+	clock.WaitForTimers(t, 1)
+	clock.Advance(10 * time.Second)
+	waitResult(t, results)
+
+	entries := readDatagrams(server)
+	if len(entries) != 3 {
+		t.Fatalf("Expected start, signal and end entries, got %q", entries)
+	}
+
+	signal := journalFields(entries[1])
+	expectedSignal := map[string]string{
+		"MESSAGE":           "sending signal TERM to command 'backup'",
+		"PRIORITY":          "6",
+		"SYSLOG_FACILITY":   "9",
+		"SYSLOG_IDENTIFIER": "timeout",
+		"TIMEOUT_EVENT":     "signal",
+		"TIMEOUT_PID":       "4242",
+		"TIMEOUT_SIGNAL":    "TERM",
+	}
+	for name, value := range expectedSignal {
+		if signal[name] != value {
+			t.Errorf("Expected %s=%s, got %q", name, value, signal[name])
+		}
+	}
+
+	end := journalFields(entries[2])
+	if end["TIMEOUT_REASON"] != ReasonTimeout || end["TIMEOUT_EXIT_CODE"] != "124" || end["TIMEOUT_COMMAND"] != "backup --full" {
+		t.Errorf("Unexpected end entry: %v", end)
+	}
+}
+
+func TestJournalEntryMultiline(t *testing.T) {
+	h := &syslogHandler{journal: true, facility: 1}
+	entry := h.journalEntry("hello", severityInfo, []slog.Attr{slog.String("line", "a\nb")})
+
+	var length [8]byte
+	binary.LittleEndian.PutUint64(length[:], 3)
+	expected := "TIMEOUT_LINE\n" + string(length[:]) + "a\nb\n"
+	if !strings.HasSuffix(string(entry), expected) {
+		t.Errorf("Expected a length-prefixed field, got %q", entry)
+	}
+	if !strings.HasPrefix(string(entry), "MESSAGE=hello\nPRIORITY=6\n") {
+		t.Errorf("Expected the message and priority first, got %q", entry)
+	}
+}
+
+func TestRunTimeoutSyslogUnavailable(t *testing.T) {
+	dir := t.TempDir()
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName:    "TERM",
+		Syslog:        "user",
+		SyslogSocket:  filepath.Join(dir, "no-syslog"),
+		JournalSocket: filepath.Join(dir, "no-journal"),
+		Stdout:        &stdout,
+		Stderr:        &stderr,
+	}
+
+	result := runTimeout(config, []string{"5s", "true"})
+
+	if result.ExitCode != 0 {
+		t.Errorf("Expected the command to run anyway, got %d", result.ExitCode)
+	}
+	if !strings.HasPrefix(stderr.String(), "timeout: cannot connect to syslog") {
+		t.Errorf("Expected a warning, got %q", stderr.String())
+	}
+}
+
+func TestRunTimeoutSyslogInvalid(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", Syslog: "nope", Stdout: &stdout, Stderr: &stderr}
+
+	result := runTimeout(config, []string{"5s", "true"})
+
+	if result.ExitCode != 125 {
+		t.Errorf("Expected exit code 125, got %d", result.ExitCode)
+	}
+	if !strings.Contains(stderr.String(), "invalid syslog facility 'nope'") {
+		t.Errorf("Expected an error message, got %q", stderr.String())
+	}
+}
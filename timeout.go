@@ -12,16 +12,19 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"log/slog"
+	"math"
 	"os"
-	"os/exec"
 	"os/signal"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
+	"unicode"
 )
 
 // Version information
@@ -40,20 +43,235 @@ type Config struct {
 	Help           bool
 	Version        bool
 
+	// Readiness probes that gate the start of the main timeout
+	ReadyTimeout     string
+	ReadyTCP         string
+	ReadyFile        string
+	ReadyStdoutRegex string
+	ReadyCmd         string
+
+	// KillOnOutput holds [stdout:|stderr:]REGEX patterns that stop the
+	// command as soon as a line of its output matches
+	KillOnOutput []string
+
+	// TailOnTimeout is the number of trailing output lines per stream
+	// printed to stderr when the command times out
+	TailOnTimeout string
+
+	// DumpSignal, when set, is sent before the timeout signal so the
+	// command can dump its stacks; DumpWait bounds how long it may take and
+	// DumpFile receives the stderr written meanwhile
+	DumpSignal string
+	DumpWait   string
+	DumpFile   string
+
+	// OnTimeout is a shell command run before the command is signalled,
+	// bounded by OnTimeoutLimit
+	OnTimeout      string
+	OnTimeoutLimit string
+
+	// OnExit is a shell command run after the command has been reaped.
+	// Its failure only changes the exit status when OnExitStrict is set.
+	OnExit       string
+	OnExitStrict bool
+
+	// TimeoutExitCode and KillExitCode replace the exit status when the
+	// command is stopped on timeout, KillExitCode when it took a KILL.
+	// MapExit holds FROM:TO pairs, separated by commas, for any other status.
+	TimeoutExitCode string
+	KillExitCode    string
+	MapExit         string
+
+	// Scale multiplies every duration by a positive factor, for runners
+	// slower than usual
+	Scale string
+
+	// Report is the path of a JSON report written once the command ends
+	Report string
+
+	// MetricsFile receives Prometheus metrics about the run and StatsD is
+	// the HOST:PORT of a StatsD server sent them, labelled with the
+	// NAME=VALUE pairs of MetricsLabels
+	MetricsFile   string
+	StatsD        string
+	MetricsLabels []string
+
+	// NotifyURL receives a JSON notification when the command times out,
+	// or the body rendered from the NotifyTemplate file
+	NotifyURL      string
+	NotifyTemplate string
+
+	// Parallel runs several COMMANDs separated by ":::" at once, each with
+	// its own DURATION; Deadline bounds them all and FailFast stops the
+	// others once one fails
+	Parallel bool
+	Deadline string
+	FailFast bool
+
+	// Timestamps ("rfc3339" or "elapsed") and Prefix are written in front
+	// of every line of the command's output
+	Timestamps string
+	Prefix     string
+
+	// StdoutFile, StderrFile and CombinedFile receive the command's output
+	// instead of stdout and stderr, or as well with Tee. Logs are rotated
+	// once they would grow past MaxLogSize.
+	StdoutFile   string
+	StderrFile   string
+	CombinedFile string
+	Tee          bool
+	MaxLogSize   string
+
+	// MaxOutput caps the bytes the command may write; MaxOutputAction is
+	// "kill" (the default) to stop it as on timeout or "truncate" to drop
+	// the rest of its output
+	MaxOutput       string
+	MaxOutputAction string
+
+	// StdinMode is "inherit" (the default), "null", "close" or a file to
+	// read the command's stdin from. StdinTimeout stops a command that has
+	// been waiting this long for input from the terminal.
+	StdinMode    string
+	StdinTimeout string
+
+	// LogFormat ("text", "json" or "logfmt"), LogLevel and LogFile control
+	// how timeout's own events are logged; text to stderr by default
+	LogFormat string
+	LogLevel  string
+	LogFile   string
+
+	// Logger receives timeout's own events; nil means one built from the
+	// options above
+	Logger *slog.Logger
+
+	// Syslog is the facility under which timeout's events are also sent to
+	// journald or the local syslog daemon
+	Syslog string
+
+	// Env holds NAME=VALUE pairs added to the command's environment
+	Env []string
+
+	// Pty runs the command on a pseudo-terminal in its own process group,
+	// which timeout signals as a whole
+	Pty bool
+
 	// For testing
 	Stdout io.Writer
 	Stderr io.Writer
 	Stdin  io.Reader
+
+	// Clock and Starter replace the real clock and os/exec; Interrupts
+	// replaces the SIGINT/SIGTERM notifications. Nil means the real thing.
+	Clock      Clock
+	Starter    ProcessStarter
+	Interrupts <-chan os.Signal
+
+	// JournalSocket and SyslogSocket replace the sockets of journald and
+	// the syslog daemon
+	JournalSocket string
+	SyslogSocket  string
+
+	// trace exports the run as an OpenTelemetry span, notify posts
+	// --notify-url notifications, syslog receives timeout's events for
+	// --syslog and exitMap rewrites the exit status; all are set by
+	// runTimeout
+	trace   *tracer
+	notify  *notifier
+	syslog  *syslogHandler
+	exitMap *exitMapping
 }
 
 // Result holds the result of running a command
 type Result struct {
 	ExitCode int
 	Error    error
+
+	// Reason describes how the command ended (one of the Reason constants)
+	Reason string
+
+	// Matched is the output line that triggered --kill-on-output
+	Matched string
+
+	// Elapsed is how long the command ran
+	Elapsed time.Duration
+
+	// Signals lists the names of the signals sent to the command, in order
+	Signals []string
+
+	// DumpFile is the file the --dump-signal stack dump was saved to
+	DumpFile string
+
+	// OnTimeout records the --on-timeout hook, if it ran
+	OnTimeout *HookResult
+
+	// OnExit records the --on-exit hook, if it ran
+	OnExit *HookResult
+
+	// Truncated reports that output past --max-output was dropped
+	Truncated bool
+
+	// OriginalExitCode is the exit status before --timeout-exit-code,
+	// --kill-exit-code or --map-exit changed it, as reported by Remapped
+	OriginalExitCode int
+	Remapped         bool
+
+	// Limit is the time the command was allowed, 0 for no limit
+	Limit time.Duration
+
+	// MaxRSS is the command's peak resident set size in bytes, 0 if unknown
+	MaxRSS int64
+
+	// StdoutTail and StderrTail hold the last lines of output, kept for
+	// --notify-url
+	StdoutTail []string
+	StderrTail []string
+
+	// Start is when the command started, and SignalTimes when each of
+	// Signals was sent
+	Start       time.Time
+	SignalTimes []time.Time
+
+	// Command is the command line that was run, and Name the run-steps
+	// step it belongs to
+	Command []string
+	Name    string
+
+	// Commands holds the result of each command run by --parallel or
+	// run-steps
+	Commands []Result
+}
+
+// Reasons reported in Result.Reason
+const (
+	ReasonCompleted = "completed"
+	ReasonTimeout   = "timeout"
+	ReasonSignal    = "signal"
+	ReasonNotReady  = "not-ready"
+	ReasonOutput    = "output"
+	ReasonError     = "error"
+	ReasonDeadline  = "deadline"
+	ReasonCancelled = "cancelled"
+	ReasonBudget    = "budget"
+	ReasonSkipped   = "skipped"
+
+	ReasonOutputLimit = "output-limit"
+	ReasonStdin       = "stdin"
+)
+
+// stoppedByTimeout reports whether reason means timeout stopped the
+// command, rather than it exiting, failing to start or being interrupted
+func stoppedByTimeout(reason string) bool {
+	switch reason {
+	case ReasonCompleted, ReasonError, ReasonSignal, ReasonSkipped, "":
+		return false
+	}
+	return true
 }
 
 func usage(w io.Writer, progName string) {
 	fmt.Fprintf(w, "Usage: %s [OPTION] DURATION COMMAND [ARG]...\n", progName)
+	fmt.Fprintf(w, "  or:  %s [OPTION] --parallel DURATION COMMAND [ARG]... [::: COMMAND [ARG]...]...\n", progName)
+	fmt.Fprintf(w, "  or:  %s [OPTION] run-steps FILE\n", progName)
 	fmt.Fprintf(w, "  or:  %s [OPTION]\n", progName)
 	fmt.Fprintf(w, "Start COMMAND, and kill it if still running after DURATION.\n\n")
 	fmt.Fprintf(w, "Options:\n")
@@ -61,48 +279,235 @@ func usage(w io.Writer, progName string) {
 	flag.PrintDefaults()
 	fmt.Fprintf(w, "\nDURATION is a floating point number with an optional suffix:\n")
 	fmt.Fprintf(w, "'s' for seconds (the default), 'm' for minutes, 'h' for hours or 'd' for days.\n")
-	fmt.Fprintf(w, "A duration of 0 disables the associated timeout.\n\n")
+	fmt.Fprintf(w, "Go-style sequences such as '1h30m' or '500ms' are also accepted, with the\n")
+	fmt.Fprintf(w, "units 'ns', 'us', 'ms', 's', 'm', 'h' and 'd'.  Numbers may be hexadecimal\n")
+	fmt.Fprintf(w, "floats such as '0x1p3'.  A duration of 0, 'inf' or 'infinity' disables the\n")
+	fmt.Fprintf(w, "associated timeout; larger values than can be represented are clamped.\n\n")
 	fmt.Fprintf(w, "If the command times out, and --preserve-status is not set, then exit with\n")
 	fmt.Fprintf(w, "status 124.  Otherwise, exit with the status of COMMAND.  If no signal\n")
 	fmt.Fprintf(w, "is specified, send the TERM signal upon timeout.  The TERM signal kills\n")
 	fmt.Fprintf(w, "any process that does not block or catch that signal.  It may be necessary\n")
 	fmt.Fprintf(w, "to use the KILL (9) signal, since this signal cannot be caught, in which\n")
-	fmt.Fprintf(w, "case the exit status is 128+9 rather than 124.\n")
+	fmt.Fprintf(w, "case the exit status is 128+9 rather than 124.\n\n")
+	fmt.Fprintf(w, "If a readiness probe (--ready-tcp, --ready-file, --ready-stdout-regex or\n")
+	fmt.Fprintf(w, "--ready-cmd) is given, DURATION starts once every probe has passed.  If the\n")
+	fmt.Fprintf(w, "probes do not pass within --ready-timeout (DURATION by default), the command\n")
+	fmt.Fprintf(w, "is signalled as on timeout and the exit status is %d.\n\n", ExitNotReady)
+	fmt.Fprintf(w, "A --kill-on-output match is handled as an early timeout: the command is\n")
+	fmt.Fprintf(w, "signalled and escalated in the same way and the exit status is the same.\n\n")
+	fmt.Fprintf(w, "--timeout-exit-code and --kill-exit-code replace the exit status of a\n")
+	fmt.Fprintf(w, "command stopped on timeout, the latter when KILL had to be sent; --map-exit\n")
+	fmt.Fprintf(w, "rules such as 124:75,1:0 replace any other status.\n\n")
+	fmt.Fprintf(w, "Defaults for any option can be set in $TIMEOUT_CONFIG or\n")
+	fmt.Fprintf(w, "$XDG_CONFIG_HOME/timeout/config.toml, at the top level or in [profile.NAME]\n")
+	fmt.Fprintf(w, "tables selected with --profile.  Each option can also be set through an\n")
+	fmt.Fprintf(w, "environment variable named after it, e.g. TIMEOUT_KILL_AFTER for --kill-after.\n")
+	fmt.Fprintf(w, "Options given on the command line take precedence over the environment,\n")
+	fmt.Fprintf(w, "which takes precedence over the profile and then the top level of the file.\n")
+	fmt.Fprintf(w, "--scale=FACTOR (or TIMEOUT_SCALE) multiplies every duration, for slow runners.\n\n")
+	fmt.Fprintf(w, "With --parallel, the commands separated by ':::' run at once, each under\n")
+	fmt.Fprintf(w, "DURATION and the other options, with their output prefixed by [N:COMMAND].\n")
+	fmt.Fprintf(w, "--deadline stops all of them once it elapses and --fail-fast stops the others\n")
+	fmt.Fprintf(w, "as soon as one fails.  The exit status is that of the first command to fail.\n\n")
+	fmt.Fprintf(w, "run-steps runs the steps listed in the JSON or YAML file FILE one after the\n")
+	fmt.Fprintf(w, "other, each with its own timeout, within the file's total timeout, and prints\n")
+	fmt.Fprintf(w, "a summary of the steps to stderr.\n\n")
+	fmt.Fprintf(w, "Timeout's own messages go to stderr as 'timeout: ...' lines.  --log-format=json\n")
+	fmt.Fprintf(w, "or logfmt writes them as structured events instead, --log-level chooses how\n")
+	fmt.Fprintf(w, "much to log and --log-file appends the log to a file.\n")
 }
 
+// durationUnits maps the unit suffixes accepted by parseDuration to their
+// length
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"µs": time.Microsecond, // U+00B5 micro sign
+	"μs": time.Microsecond, // U+03BC Greek small letter mu
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+}
+
+// parseDuration parses a DURATION operand or option value.
+//
+// A duration is either a single number with an optional s, m, h or d suffix
+// (seconds by default), as GNU timeout accepts, or a Go-style sequence of
+// numbers each followed by a unit such as "1h30m" or "2.5us". Numbers may be
+// decimal or hexadecimal floats ("0x1p3"). "inf" and "infinity" mean no
+// timeout and are returned as 0, like a zero duration. Values too large to
+// represent are clamped to the longest possible duration, and positive values
+// shorter than a nanosecond are rounded up to one.
 func parseDuration(s string) (time.Duration, error) {
-	if s == "" {
+	input := strings.TrimSpace(s)
+	if input == "" {
 		return 0, fmt.Errorf("empty duration")
 	}
 
-	// Handle suffixes
-	var multiplier time.Duration = time.Second
-	suffix := s[len(s)-1:]
-
-	switch suffix {
-	case "s":
-		s = s[:len(s)-1]
-		multiplier = time.Second
-	case "m":
-		s = s[:len(s)-1]
-		multiplier = time.Minute
-	case "h":
-		s = s[:len(s)-1]
-		multiplier = time.Hour
-	case "d":
-		s = s[:len(s)-1]
-		multiplier = 24 * time.Hour
-	default:
-		// No suffix, assume seconds
-		multiplier = time.Second
+	switch strings.ToLower(strings.TrimPrefix(input, "+")) {
+	case "inf", "infinity":
+		return 0, nil
+	case "nan", "-nan":
+		return 0, fmt.Errorf("NaN is not a valid duration")
+	}
+	if strings.HasPrefix(input, "-") {
+		return 0, fmt.Errorf("negative duration")
 	}
+	rest := strings.TrimPrefix(input, "+")
+
+	var total float64 // nanoseconds
+	components := 0
+	for rest != "" {
+		number, value, err := scanNumber(rest)
+		if err != nil {
+			return 0, err
+		}
+		rest = rest[len(number):]
+
+		unitText := scanUnit(rest)
+		rest = rest[len(unitText):]
+		unit := time.Second
+		if unitText != "" {
+			var ok bool
+			if unit, ok = durationUnits[unitText]; !ok {
+				return 0, fmt.Errorf("unknown unit '%s'", unitText)
+			}
+		}
 
-	// Parse the numeric part
-	if f, err := strconv.ParseFloat(s, 64); err != nil {
-		return 0, err
-	} else {
-		return time.Duration(f * float64(multiplier)), nil
+		if unitText == "" {
+			// A bare number must be the whole duration
+			switch {
+			case rest == "" && components == 0:
+			case rest == "" || isDigit(rest[0]) || rest[0] == ' ' || rest[0] == '\t':
+				return 0, fmt.Errorf("missing unit after '%s'", number)
+			default:
+				return 0, fmt.Errorf("unexpected '%s' after '%s'", rest, number)
+			}
+		}
+		rest = strings.TrimLeft(rest, " \t")
+
+		total += value * float64(unit)
+		components++
+	}
+
+	if math.IsInf(total, 0) || total >= math.MaxInt64 {
+		return math.MaxInt64, nil
+	}
+	d := time.Duration(math.Round(total))
+	if d == 0 && total > 0 {
+		d = time.Nanosecond
 	}
+	return d, nil
+}
+
+// scanNumber returns the decimal or hexadecimal floating point number at the
+// start of s and its value
+func scanNumber(s string) (string, float64, error) {
+	i := 0
+	hex := len(s) > 1 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X')
+	digit, exponent := isDigit, "eE"
+	if hex {
+		i = 2
+		digit, exponent = isHexDigit, "pP"
+	}
+
+	mantissa := 0
+	for ; i < len(s) && digit(s[i]); i++ {
+		mantissa++
+	}
+	if i < len(s) && s[i] == '.' {
+		for i++; i < len(s) && digit(s[i]); i++ {
+			mantissa++
+		}
+	}
+	if mantissa == 0 {
+		if hex {
+			return "", 0, fmt.Errorf("invalid hexadecimal number '%s'", s)
+		}
+		return "", 0, fmt.Errorf("expected a number at '%s'", s)
+	}
+
+	hasExponent := false
+	if i < len(s) && strings.IndexByte(exponent, s[i]) >= 0 {
+		j := i + 1
+		if j < len(s) && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+		start := j
+		for ; j < len(s) && isDigit(s[j]); j++ {
+		}
+		if j > start {
+			i, hasExponent = j, true
+		} else if hex {
+			return "", 0, fmt.Errorf("invalid exponent in '%s'", s[:j])
+		}
+	}
+
+	number := s[:i]
+	text := number
+	if hex && !hasExponent {
+		// strconv requires an exponent on hexadecimal floats
+		text += "p0"
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return "", 0, fmt.Errorf("invalid number '%s'", number)
+	}
+	return number, value, nil
+}
+
+// scanUnit returns the run of letters at the start of s
+func scanUnit(s string) string {
+	for i, r := range s {
+		if !unicode.IsLetter(r) {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// parseScale parses a --scale factor; an empty string means no scaling
+func parseScale(s string) (float64, error) {
+	if s == "" {
+		return 1, nil
+	}
+	scale, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(scale) || math.IsInf(scale, 0) || scale <= 0 {
+		return 0, fmt.Errorf("invalid scale factor '%s': must be a positive number", s)
+	}
+	return scale, nil
+}
+
+// scaleOption scales the value d of the named duration option, logging the
+// result
+func scaleOption(config Config, name string, d time.Duration, scale float64) time.Duration {
+	scaled := scaleDuration(d, scale)
+	if scale != 1 && d > 0 {
+		factor := strconv.FormatFloat(scale, 'g', -1, 64)
+		loggerFor(config).Info(fmt.Sprintf("%s %s \u00d7%s = %s", name, d, factor, scaled),
+			"event", "scale", "option", name, "duration", d, "scale", scale, "scaled", scaled)
+	}
+	return scaled
+}
+
+// scaleDuration multiplies d by scale, saturating at the longest
+// representable duration
+func scaleDuration(d time.Duration, scale float64) time.Duration {
+	scaled := float64(d) * scale
+	if scaled >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(scaled)
 }
 
 func parseSignal(s string) (syscall.Signal, error) {
@@ -117,24 +522,6 @@ func parseSignal(s string) (syscall.Signal, error) {
 		s = "SIG" + s
 	}
 
-	signals := map[string]syscall.Signal{
-		"SIGTERM": syscall.SIGTERM,
-		"SIGKILL": syscall.SIGKILL,
-		"SIGINT":  syscall.SIGINT,
-		"SIGQUIT": syscall.SIGQUIT,
-		"SIGHUP":  syscall.SIGHUP,
-		"SIGUSR1": syscall.SIGUSR1,
-		"SIGUSR2": syscall.SIGUSR2,
-		"SIGPIPE": syscall.SIGPIPE,
-		"SIGALRM": syscall.SIGALRM,
-		"SIGCHLD": syscall.SIGCHLD,
-		"SIGCONT": syscall.SIGCONT,
-		"SIGSTOP": syscall.SIGSTOP,
-		"SIGTSTP": syscall.SIGTSTP,
-		"SIGTTIN": syscall.SIGTTIN,
-		"SIGTTOU": syscall.SIGTTOU,
-	}
-
 	if sig, ok := signals[s]; ok {
 		return sig, nil
 	}
@@ -142,6 +529,36 @@ func parseSignal(s string) (syscall.Signal, error) {
 	return 0, fmt.Errorf("invalid signal: %s", s)
 }
 
+// signals maps the supported signal names to their values
+var signals = map[string]syscall.Signal{
+	"SIGTERM": syscall.SIGTERM,
+	"SIGKILL": syscall.SIGKILL,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+	"SIGPIPE": syscall.SIGPIPE,
+	"SIGALRM": syscall.SIGALRM,
+	"SIGCHLD": syscall.SIGCHLD,
+	"SIGCONT": syscall.SIGCONT,
+	"SIGSTOP": syscall.SIGSTOP,
+	"SIGTSTP": syscall.SIGTSTP,
+	"SIGTTIN": syscall.SIGTTIN,
+	"SIGTTOU": syscall.SIGTTOU,
+}
+
+// formatSignal returns the name of sig without the SIG prefix, or its number
+// when it has no name
+func formatSignal(sig syscall.Signal) string {
+	for name, s := range signals {
+		if s == sig {
+			return strings.TrimPrefix(name, "SIG")
+		}
+	}
+	return strconv.Itoa(int(sig))
+}
+
 // runTimeout executes the timeout logic and returns the result
 func runTimeout(config Config, args []string) Result {
 	if config.Help {
@@ -162,130 +579,709 @@ func runTimeout(config Config, args []string) Result {
 		return Result{ExitCode: 125}
 	}
 
-	// Parse timeout
-	timeoutDuration, err := parseDuration(args[0])
+	if config.Clock == nil {
+		config.Clock = realClock{}
+	}
+	if config.Starter == nil {
+		config.Starter = execStarter{}
+		if config.Pty {
+			config.Starter = ptyStarter{}
+		}
+	}
+
+	if _, err := parseMetricLabels(config); err != nil {
+		fmt.Fprintf(config.Stderr, "timeout: %v\n", err)
+		return Result{ExitCode: 125}
+	}
+	if err := parseStatsDAddr(config); err != nil {
+		fmt.Fprintf(config.Stderr, "timeout: %v\n", err)
+		return Result{ExitCode: 125}
+	}
+	notify, err := parseNotifier(config)
 	if err != nil {
-		fmt.Fprintf(config.Stderr, "timeout: invalid time interval '%s'\n", args[0])
+		fmt.Fprintf(config.Stderr, "timeout: %v\n", err)
 		return Result{ExitCode: 125}
 	}
+	config.notify = notify
+	exitMap, err := parseExitMapping(config)
+	if err != nil {
+		fmt.Fprintf(config.Stderr, "timeout: %v\n", err)
+		return Result{ExitCode: 125}
+	}
+	config.exitMap = exitMap
 
-	// Get command and args
-	command := args[1]
-	cmdArgs := args[2:]
+	if config.Logger == nil {
+		logger, closeLog, err := openLogger(config)
+		if err != nil {
+			fmt.Fprintf(config.Stderr, "timeout: %v\n", err)
+			return Result{ExitCode: 125}
+		}
+		defer closeLog()
+		config.Logger = logger
+	}
 
-	// Parse signal
-	timeoutSignal, err := parseSignal(config.SignalName)
+	if config.Syslog != "" {
+		facility, err := parseSyslogFacility(config)
+		if err != nil {
+			fmt.Fprintf(config.Stderr, "timeout: %v\n", err)
+			return Result{ExitCode: 125}
+		}
+		// The command runs anyway, with its events left on stderr
+		if h, err := openSyslog(config, facility); err != nil {
+			loggerFor(config).Warn(err.Error(), "event", "error", "error", err)
+		} else {
+			defer h.Close()
+			config.syslog = h
+		}
+	}
+
+	trace, err := newTracer()
+	if err != nil {
+		loggerFor(config).Warn(fmt.Sprintf("not exporting trace: %v", err), "event", "error", "error", err)
+	} else if trace != nil {
+		config.trace = trace
+		config.Env = append(append([]string{}, config.Env...), "TRACEPARENT="+trace.traceparent())
+	}
+
+	if config.Parallel {
+		return runParallel(config, args)
+	}
+	if config.Deadline != "" || config.FailFast {
+		fmt.Fprintf(config.Stderr, "timeout: --deadline and --fail-fast require --parallel\n")
+		return Result{ExitCode: 125}
+	}
+	if args[0] == stepsCommand {
+		return runSteps(config, args[1:])
+	}
+
+	e, err := newExecution(config, args[0], args[1])
 	if err != nil {
 		fmt.Fprintf(config.Stderr, "timeout: %v\n", err)
 		return Result{ExitCode: 125}
 	}
 
+	files, err := openOutputFiles(config)
+	if err != nil {
+		fmt.Fprintf(config.Stderr, "timeout: %v\n", err)
+		return Result{ExitCode: 125}
+	}
+	e.stdout, e.stderr = files.writers(config.Stdout, config.Stderr)
+
+	result := e.run(ProcessSpec{Name: args[1], Args: args[2:]})
+	if err := files.Close(); err != nil {
+		fmt.Fprintf(config.Stderr, "timeout: %v\n", err)
+	}
+	return finish(config, args[1:], result)
+}
+
+// finish writes the --report and runs the --on-exit hook for result
+func finish(config Config, command []string, result Result) Result {
+	log := loggerFor(config)
+	log.Debug(fmt.Sprintf("command '%s' ended (%s) with status %d", command[0], result.Reason, result.ExitCode),
+		"event", "end", "command", command, "reason", result.Reason, "exit_code", result.ExitCode, "elapsed", result.Elapsed)
+
+	if config.exitMap != nil {
+		result = config.exitMap.apply(result)
+		if result.Remapped {
+			log.Info(fmt.Sprintf("exit status %d mapped to %d", result.OriginalExitCode, result.ExitCode),
+				"event", "exit-mapped", "original_exit_code", result.OriginalExitCode, "exit_code", result.ExitCode)
+		}
+	}
+
+	if config.Report != "" {
+		if err := writeReport(config.Report, command, result); err != nil {
+			log.Error(err.Error(), "event", "error", "error", err)
+		}
+	}
+	if config.MetricsFile != "" {
+		labels, _ := parseMetricLabels(config) // validated by runTimeout
+		if err := writeMetrics(config.MetricsFile, result, labels); err != nil {
+			log.Error(err.Error(), "event", "error", "error", err)
+		}
+	}
+
+	if config.OnExit != "" {
+		result.OnExit = runExitHook(config, result)
+		if config.OnExitStrict && result.ExitCode == 0 && hookFailed(result.OnExit) {
+			result.ExitCode = 125
+		}
+	}
+
+	if config.trace != nil {
+		if err := config.trace.export(command, result, config.Clock.Now()); err != nil {
+			log.Error(err.Error(), "event", "error", "error", err)
+		}
+	}
+	if config.notify != nil && stoppedByTimeout(result.Reason) {
+		if err := config.notify.notify(command, result); err != nil {
+			log.Error(err.Error(), "event", "error", "error", err)
+		}
+	}
+	if config.StatsD != "" {
+		labels, _ := parseMetricLabels(config) // validated by runTimeout
+		if err := sendStatsD(config.StatsD, statsdPayload(result, labels)); err != nil {
+			log.Debug(fmt.Sprintf("cannot send statsd metrics: %v", err), "event", "error", "error", err)
+		}
+	}
+
+	return result
+}
+
+// newExecution parses the options in config and the DURATION operand into
+// an execution of command
+func newExecution(config Config, duration, command string) (*execution, error) {
+	// Parse timeout
+	timeoutDuration, err := parseDuration(duration)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time interval '%s': %v", duration, err)
+	}
+
+	// Parse duration scale factor
+	scale, err := parseScale(config.Scale)
+	if err != nil {
+		return nil, err
+	}
+	timeoutDuration = scaleOption(config, "duration", timeoutDuration, scale)
+
+	// Parse signal
+	timeoutSignal, err := parseSignal(config.SignalName)
+	if err != nil {
+		return nil, err
+	}
+
 	// Parse kill-after duration
 	var killAfterDuration time.Duration
 	if config.KillAfter != "" {
 		killAfterDuration, err = parseDuration(config.KillAfter)
 		if err != nil {
-			fmt.Fprintf(config.Stderr, "timeout: invalid time interval '%s'\n", config.KillAfter)
-			return Result{ExitCode: 125}
+			return nil, fmt.Errorf("invalid time interval '%s': %v", config.KillAfter, err)
 		}
+		killAfterDuration = scaleOption(config, "kill-after", killAfterDuration, scale)
+	}
+
+	// Parse readiness probes
+	ready, err := parseReadiness(config, scale)
+	if err != nil {
+		return nil, err
+	}
+	// Without --ready-timeout the command has DURATION to become ready, so
+	// that a command that never does cannot run unbounded
+	if ready != nil && config.ReadyTimeout == "" {
+		ready.timeout = timeoutDuration
+	}
+
+	// Parse output triggers
+	triggers, err := parseOutputTriggers(config.KillOnOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse tail size
+	var tail *outputTail
+	if config.TailOnTimeout != "" {
+		n, err := strconv.Atoi(config.TailOnTimeout)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid line count '%s'", config.TailOnTimeout)
+		}
+		if n > 0 {
+			tail = newOutputTail(n)
+		}
+	}
+
+	// Keep the last lines of output for --notify-url
+	var notifyTail *outputTail
+	if config.NotifyURL != "" {
+		notifyTail = newOutputTail(notifyTailLines)
+	}
+
+	// Parse stack dump settings
+	dump, err := parseStackDump(config, scale)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse on-timeout limit
+	onTimeoutLimit := defaultHookLimit
+	if config.OnTimeoutLimit != "" {
+		onTimeoutLimit, err = parseDuration(config.OnTimeoutLimit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time interval '%s': %v", config.OnTimeoutLimit, err)
+		}
+	}
+	if config.OnTimeout != "" {
+		onTimeoutLimit = scaleOption(config, "on-timeout-limit", onTimeoutLimit, scale)
+	}
+
+	// Parse output timestamps and prefix
+	stamps, err := newStampedOutput(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse output limit
+	limit, err := parseOutputLimit(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse stdin timeout
+	var stdinTimeout time.Duration
+	if config.StdinTimeout != "" {
+		stdinTimeout, err = parseDuration(config.StdinTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time interval '%s': %v", config.StdinTimeout, err)
+		}
+		if stdinTimeout > 0 && config.Pty {
+			return nil, fmt.Errorf("--stdin-timeout cannot be used with --pty")
+		}
+		stdinTimeout = scaleOption(config, "stdin-timeout", stdinTimeout, scale)
+	}
+
+	e := &execution{
+		config:    config,
+		log:       loggerFor(config),
+		command:   command,
+		timeout:   timeoutDuration,
+		signal:    timeoutSignal,
+		killAfter: killAfterDuration,
+		ready:     ready,
+		triggers:  triggers,
+		tail:      tail,
+		dump:      dump,
+		stamps:    stamps,
+		limit:     limit,
+
+		notifyTail: notifyTail,
+
+		stdinTimeout: stdinTimeout,
+		stdout:       config.Stdout,
+		stderr:       config.Stderr,
+
+		onTimeoutLimit: onTimeoutLimit,
 	}
+	return e, nil
+}
+
+// execution tracks a started command and how to stop it
+type execution struct {
+	config    Config
+	log       *slog.Logger
+	command   string
+	timeout   time.Duration
+	signal    syscall.Signal
+	killAfter time.Duration
+	ready     *readiness
+	triggers  *outputTriggers
+	tail      *outputTail
+	dump      *stackDump
+	stamps    *stampedOutput
+	limit     *outputLimit
+
+	// notifyTail keeps the end of the output for --notify-url
+	notifyTail *outputTail
+
+	// stdinTimeout is how long the command may wait for terminal input;
+	// watchStdin is set when its stdin is a terminal to watch
+	stdinTimeout time.Duration
+	watchStdin   bool
+
+	onTimeoutLimit time.Duration
 
-	// Create context with timeout (0 duration means no timeout)
-	var ctx context.Context
-	var cancel context.CancelFunc
-	if timeoutDuration > 0 {
-		ctx, cancel = context.WithTimeout(context.Background(), timeoutDuration)
-		defer cancel()
-	} else {
-		ctx = context.Background()
+	// stop, when set, delivers the reason to stop the command early
+	stop <-chan string
+
+	// stdout and stderr receive the command's output
+	stdout io.Writer
+	stderr io.Writer
+
+	proc      Process
+	status    ExitStatus
+	done      chan error
+	start     time.Time
+	signals   []string
+	sigTimes  []time.Time
+	dumpFile  string
+	onTimeout *HookResult
+}
+
+// run starts the command described by spec and supervises it until it exits
+func (e *execution) run(spec ProcessSpec) Result {
+	config := e.config
+
+	var stdoutTaps, stderrTaps []io.Writer
+	if e.ready != nil && e.ready.stdout != nil {
+		stdoutTaps = append(stdoutTaps, e.ready.stdout)
+	}
+	if e.triggers != nil {
+		stdoutTaps = append(stdoutTaps, e.triggers.stdout)
+		stderrTaps = append(stderrTaps, e.triggers.stderr)
+	}
+	if e.tail != nil {
+		stdoutTaps = append(stdoutTaps, e.tail.stdout)
+		stderrTaps = append(stderrTaps, e.tail.stderr)
+	}
+	if e.notifyTail != nil {
+		stdoutTaps = append(stdoutTaps, e.notifyTail.stdout)
+		stderrTaps = append(stderrTaps, e.notifyTail.stderr)
+	}
+	if e.dump != nil && e.dump.capture != nil {
+		stderrTaps = append(stderrTaps, e.dump.capture)
 	}
 
-	// Create command
-	cmd := exec.CommandContext(ctx, command, cmdArgs...)
-	cmd.Stdout = config.Stdout
-	cmd.Stderr = config.Stderr
-	cmd.Stdin = config.Stdin
+	stdout, stderr := e.stdout, e.stderr
+	if e.stamps != nil {
+		stdout, stderr = e.stamps.wrap(stdout, stderr)
+	}
+	if e.limit != nil {
+		if e.limit.truncate {
+			e.limit.truncated = func() {
+				e.log.Warn(fmt.Sprintf("output of command '%s' truncated after %d bytes", e.command, e.limit.max),
+					"event", "output-truncated", "command", e.command, "bytes", e.limit.max)
+			}
+		}
+		stdout, stderr = e.limit.wrap(stdout), e.limit.wrap(stderr)
+	}
+	spec.Stdout = tee(stdout, stdoutTaps...)
+	spec.Stderr = tee(stderr, stderrTaps...)
+
+	// Open stdin
+	command := append([]string{spec.Name}, spec.Args...)
+	stdin, release, err := openStdin(config)
+	if err != nil {
+		fmt.Fprintf(config.Stderr, "timeout: %v\n", err)
+		return Result{ExitCode: 125, Error: err, Reason: ReasonError, Command: command}
+	}
+	defer release()
+	spec.Stdin = stdin
+	spec.Env = config.Env
+	// As with GNU timeout, --foreground leaves the command in timeout's
+	// process group so that it can use the terminal
+	spec.Group = !config.Foreground
+	if e.stdinTimeout > 0 && watchesStdin(stdin) {
+		spec.Group = true
+		e.watchStdin = true
+	}
 
 	// Handle interrupt signals to clean up properly
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	defer signal.Stop(sigChan)
+	sigChan := config.Interrupts
+	if sigChan == nil {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(c)
+		sigChan = c
+	}
 
 	// Start the command
-	if err := cmd.Start(); err != nil {
-		fmt.Fprintf(config.Stderr, "Error starting command: %v\n", err)
-		return Result{ExitCode: 1, Error: err}
+	proc, err := config.Starter.Start(spec)
+	if err != nil {
+		e.log.Error(fmt.Sprintf("failed to run command '%s': %v", e.command, err),
+			"event", "error", "command", e.command, "error", err)
+		return Result{ExitCode: 1, Error: err, Reason: ReasonError, Command: command}
 	}
+	e.proc = proc
+	e.start = config.Clock.Now()
+	e.log.Debug(fmt.Sprintf("started command '%s' with pid %d", e.command, proc.Pid()),
+		"event", "start", "command", e.command, "args", spec.Args, "pid", proc.Pid())
 
-	// Wait for either completion or signal
-	done := make(chan error, 1)
+	// Wait for either completion or signal. The status is stored before
+	// done is signalled, so whoever receives from done may read it.
+	e.done = make(chan error, 1)
 	go func() {
-		done <- cmd.Wait()
+		status, err := proc.Wait()
+		e.log.Debug(fmt.Sprintf("command '%s' exited with status %d", e.command, status.Code),
+			"event", "exit", "command", e.command, "pid", proc.Pid(), "exit_code", status.Code)
+		e.status = status
+		e.done <- err
 	}()
 
-	select {
-	case <-ctx.Done():
-		// Timeout occurred
-		if config.Verbose {
-			fmt.Fprintf(config.Stderr, "timeout: sending signal %s to command '%s'\n", config.SignalName, command)
+	result := e.supervise(sigChan)
+	if e.stamps != nil {
+		e.stamps.Flush()
+	}
+	result.Command = command
+	result.Elapsed = e.elapsed()
+	result.Limit = e.timeout
+	result.Start = e.start
+	result.MaxRSS = e.status.MaxRSS
+	if e.limit != nil && e.limit.truncate {
+		select {
+		case <-e.limit.exceeded:
+			result.Truncated = true
+		default:
 		}
+	}
+	result.Signals = e.signals
+	result.SignalTimes = e.sigTimes
+	if e.notifyTail != nil {
+		e.notifyTail.stdout.Flush()
+		e.notifyTail.stderr.Flush()
+		result.StdoutTail = e.notifyTail.stdoutLines.snapshot()
+		result.StderrTail = e.notifyTail.stderrLines.snapshot()
+	}
+	result.DumpFile = e.dumpFile
+	result.OnTimeout = e.onTimeout
+	return result
+}
 
-		if cmd.Process != nil {
-			// Send the specified signal
-			if err := cmd.Process.Signal(timeoutSignal); err != nil && config.Verbose {
-				fmt.Fprintf(config.Stderr, "timeout: failed to send signal: %v\n", err)
-			}
+// supervise waits for the command to exit, stopping it when its time is up
+func (e *execution) supervise(sigChan <-chan os.Signal) Result {
+	config := e.config
+	ready := e.ready
+
+	var matched <-chan string
+	if e.triggers != nil {
+		matched = e.triggers.matched
+	}
+	var exceeded <-chan struct{}
+	if e.limit != nil && !e.limit.truncate {
+		exceeded = e.limit.exceeded
+	}
 
-			// If kill-after is specified, wait and then send KILL
-			if config.KillAfter != "" && killAfterDuration > 0 {
+	// Watch for the command stopping on a read from the terminal
+	var stdinBlocked <-chan struct{}
+	var stdinExpired <-chan time.Time
+	if e.watchStdin {
+		blocked := make(chan struct{})
+		stopWatching := make(chan struct{})
+		defer close(stopWatching)
+		go e.watchTerminalReads(blocked, stopWatching)
+		stdinBlocked = blocked
+	}
+
+	// Hold off the main timeout until the command reports ready
+	var readyDone chan error
+	if ready != nil {
+		readyCtx, cancelReady := context.WithCancel(context.Background())
+		defer cancelReady()
+		if ready.timeout > 0 {
+			readyTimer := config.Clock.NewTimer(ready.timeout)
+			defer readyTimer.Stop()
+			go func() {
 				select {
-				case <-time.After(killAfterDuration):
-					if config.Verbose {
-						fmt.Fprintf(config.Stderr, "timeout: sending signal KILL to command '%s'\n", command)
-					}
-					cmd.Process.Signal(syscall.SIGKILL)
-				case <-done:
-					// Process exited before kill-after timeout
+				case <-readyTimer.C():
+					cancelReady()
+				case <-readyCtx.Done():
 				}
-			}
+			}()
 		}
 
-		// Wait for process to finish
-		<-done
+		readyDone = make(chan error, 1)
+		go func() {
+			readyDone <- ready.wait(readyCtx)
+		}()
+	}
 
-		if config.PreserveStatus {
-			// Exit with command's status (if available)
-			if cmd.ProcessState != nil {
-				return Result{ExitCode: cmd.ProcessState.ExitCode()}
+	// Start the main timeout (0 duration means no timeout)
+	var expired <-chan time.Time
+	var timer Timer
+	startTimer := func() {
+		if e.timeout > 0 {
+			e.log.Debug(fmt.Sprintf("command '%s' times out in %s", e.command, e.timeout),
+				"event", "deadline", "command", e.command, "timeout", e.timeout, "deadline", config.Clock.Now().Add(e.timeout))
+			timer = config.Clock.NewTimer(e.timeout)
+			expired = timer.C()
+		}
+	}
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	if readyDone == nil {
+		startTimer()
+	}
+
+	for {
+		select {
+		case err := <-readyDone:
+			if err != nil {
+				e.log.Info(fmt.Sprintf("command '%s' not ready after %s", e.command, ready.timeout),
+					"event", "not-ready", "command", e.command, "ready_timeout", ready.timeout)
+				e.terminate()
+				return e.timedOut(ReasonNotReady, ExitNotReady)
 			}
-			return Result{ExitCode: 1}
-		} else {
+			readyDone = nil
+			startTimer()
+		case <-expired:
+			// Timeout occurred
+			e.terminate()
+
 			// Standard timeout exit code
-			if timeoutSignal == syscall.SIGKILL {
-				return Result{ExitCode: 128 + 9} // 128 + SIGKILL
+			if e.signal == syscall.SIGKILL {
+				return e.timedOut(ReasonTimeout, 128+9) // 128 + SIGKILL
+			}
+			return e.timedOut(ReasonTimeout, 124)
+		case line := <-matched:
+			// Output trigger matched
+			e.log.Info(fmt.Sprintf("command '%s' output matched: %s", e.command, line),
+				"event", "output-matched", "command", e.command, "line", line)
+			e.terminate()
+
+			exitCode := 124
+			if e.signal == syscall.SIGKILL {
+				exitCode = 128 + 9
+			}
+			result := e.timedOut(ReasonOutput, exitCode)
+			result.Matched = line
+			return result
+		case <-exceeded:
+			// Output limit reached
+			e.log.Info(fmt.Sprintf("command '%s' exceeded the output limit of %d bytes", e.command, e.limit.max),
+				"event", "output-limit", "command", e.command, "bytes", e.limit.max)
+			e.terminate()
+
+			exitCode := 124
+			if e.signal == syscall.SIGKILL {
+				exitCode = 128 + 9
+			}
+			return e.timedOut(ReasonOutputLimit, exitCode)
+		case <-stdinBlocked:
+			e.log.Warn(fmt.Sprintf("command '%s' is waiting for input from the terminal; stopping it in %s", e.command, e.stdinTimeout),
+				"event", "stdin-wait", "command", e.command, "stdin_timeout", e.stdinTimeout)
+			stdinBlocked = nil
+			timer := config.Clock.NewTimer(e.stdinTimeout)
+			defer timer.Stop()
+			stdinExpired = timer.C()
+		case <-stdinExpired:
+			e.terminate()
+
+			exitCode := 124
+			if e.signal == syscall.SIGKILL {
+				exitCode = 128 + 9
+			}
+			return e.timedOut(ReasonStdin, exitCode)
+		case reason := <-e.stop:
+			// Stopped by --parallel: deadline or a failed sibling
+			e.log.Info(fmt.Sprintf("stopping command '%s' (%s)", e.command, reason),
+				"event", "stop", "command", e.command, "reason", reason)
+			e.terminate()
+
+			exitCode := 124
+			if e.signal == syscall.SIGKILL {
+				exitCode = 128 + 9
 			}
-			return Result{ExitCode: 124}
+			return e.timedOut(reason, exitCode)
+		case sig := <-sigChan:
+			return e.interrupted(sig)
+		case err := <-e.done:
+			return e.completed(err)
 		}
-	case sig := <-sigChan:
-		// Signal received
-		if cmd.Process != nil {
-			cmd.Process.Signal(sig)
+	}
+}
+
+// terminate sends the timeout signal to the command, escalates to KILL once
+// kill-after has elapsed, and returns when the command has exited. The
+// --on-timeout hook runs first, then --dump-signal asks for a stack dump.
+func (e *execution) terminate() {
+	config := e.config
+	if config.OnTimeout != "" {
+		e.runTimeoutHook()
+	}
+
+	if e.dump != nil {
+		if exited := e.dumpStack(); exited {
+			return
 		}
-		<-done                       // Wait for process to finish
-		return Result{ExitCode: 130} // Standard interrupt exit code
-	case err := <-done:
-		// Command completed
-		if err != nil {
-			if exitError, ok := err.(*exec.ExitError); ok {
-				return Result{ExitCode: exitError.ExitCode()}
+	}
+
+	e.log.Info(fmt.Sprintf("sending signal %s to command '%s'", config.SignalName, e.command),
+		"event", "signal", "command", e.command, "pid", e.proc.Pid(), "signal", formatSignal(e.signal))
+
+	// Send the specified signal, and CONT so that a stopped command can
+	// act on it, as GNU timeout does
+	if err := e.sendSignal(e.signal); err != nil {
+		e.log.Info(fmt.Sprintf("failed to send signal: %v", err),
+			"event", "error", "command", e.command, "error", err)
+	}
+	if e.signal != syscall.SIGKILL && e.signal != syscall.SIGCONT {
+		e.proc.Signal(syscall.SIGCONT)
+	}
+
+	// If kill-after is specified, wait and then send KILL
+	if e.killAfter > 0 {
+		timer := config.Clock.NewTimer(e.killAfter)
+		defer timer.Stop()
+		select {
+		case <-timer.C():
+			e.log.Info(fmt.Sprintf("sending signal KILL to command '%s'", e.command),
+				"event", "kill-after", "command", e.command, "pid", e.proc.Pid(), "signal", "KILL", "kill_after", e.killAfter)
+			e.sendSignal(syscall.SIGKILL)
+		case <-e.done:
+			// Process exited before kill-after timeout
+			return
+		}
+	}
+
+	// Wait for process to finish
+	<-e.done
+}
+
+// watchTerminalReads closes blocked once the command is stopped, which with
+// its stdin on the terminal means it tried to read from it
+func (e *execution) watchTerminalReads(blocked chan<- struct{}, stop <-chan struct{}) {
+	ticker := time.NewTicker(readyPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if processStopped(e.proc.Pid()) {
+				close(blocked)
+				return
 			}
-			fmt.Fprintf(config.Stderr, "timeout: %v\n", err)
-			return Result{ExitCode: 1, Error: err}
 		}
-		return Result{ExitCode: 0}
 	}
 }
 
+// sendSignal delivers sig to the command and records it
+func (e *execution) sendSignal(sig os.Signal) error {
+	if s, ok := sig.(syscall.Signal); ok {
+		e.signals = append(e.signals, formatSignal(s))
+		e.sigTimes = append(e.sigTimes, e.config.Clock.Now())
+		if e.stamps != nil {
+			e.stamps.mark("sending signal " + formatSignal(s))
+		}
+	}
+	return e.proc.Signal(sig)
+}
+
+// elapsed returns how long the command has been running
+func (e *execution) elapsed() time.Duration {
+	return e.config.Clock.Now().Sub(e.start)
+}
+
+// timedOut builds the Result for a command stopped by timeout, honouring
+// --preserve-status
+func (e *execution) timedOut(reason string, exitCode int) Result {
+	if e.tail != nil {
+		e.tail.print(e.config.Stderr, e.command, reason, e.elapsed(), e.signals)
+	}
+
+	if e.config.PreserveStatus {
+		// Exit with command's status
+		return Result{ExitCode: e.status.Code, Reason: reason}
+	}
+	return Result{ExitCode: exitCode, Reason: reason}
+}
+
+// interrupted forwards a signal received by timeout to the command
+func (e *execution) interrupted(sig os.Signal) Result {
+	e.sendSignal(sig)
+	<-e.done                                           // Wait for process to finish
+	return Result{ExitCode: 130, Reason: ReasonSignal} // Standard interrupt exit code
+}
+
+// completed converts the command's own exit into a Result
+func (e *execution) completed(err error) Result {
+	if err != nil {
+		e.log.Error(err.Error(), "event", "error", "command", e.command, "error", err)
+		return Result{ExitCode: 1, Error: err, Reason: ReasonCompleted}
+	}
+	return Result{ExitCode: e.status.Code, Reason: ReasonCompleted}
+}
+
 var (
 	killAfter      = flag.String("kill-after", "", "also send a KILL signal if command is still running this long after the initial signal was sent")
 	signalName     = flag.String("signal", "TERM", "specify the signal to be sent on timeout")
@@ -294,12 +1290,129 @@ var (
 	verbose        = flag.Bool("verbose", false, "diagnose to stderr any signal sent upon timeout")
 	help           = flag.Bool("help", false, "display this help and exit")
 	version        = flag.Bool("version", false, "output version information and exit")
+
+	readyTimeout     = flag.String("ready-timeout", "", "fail if COMMAND is not ready within this long (default DURATION); DURATION starts once it is")
+	readyTCP         = flag.String("ready-tcp", "", "COMMAND is ready once a TCP connection to HOST:PORT succeeds")
+	readyFile        = flag.String("ready-file", "", "COMMAND is ready once PATH exists")
+	readyStdoutRegex = flag.String("ready-stdout-regex", "", "COMMAND is ready once a line of its stdout matches RE")
+	readyCmd         = flag.String("ready-cmd", "", "COMMAND is ready once this shell command exits successfully")
+
+	killOnOutput   stringList
+	metricsLabels  stringList
+	report         = flag.String("report", "", "write a JSON report of the run to FILE")
+	metricsFile    = flag.String("metrics-file", "", "write Prometheus metrics about the run to FILE for the node_exporter textfile collector")
+	statsd         = flag.String("statsd", "", "send StatsD metrics about the run to HOST:PORT over UDP")
+	notifyURL      = flag.String("notify-url", "", "POST a JSON notification to URL when COMMAND times out")
+	notifyTemplate = flag.String("notify-template", "", "render the --notify-url request body from the Go template in FILE")
+	dumpSignal     = flag.String("dump-signal", "", "on timeout, first send this signal (e.g. QUIT) so COMMAND dumps its stacks")
+	dumpWait       = flag.String("dump-wait", "", "how long to wait for the stack dump before the timeout signal (default 5s)")
+	dumpFile       = flag.String("dump-file", "", "save the stderr written while dumping stacks to FILE")
+	onTimeout      = flag.String("on-timeout", "", "on timeout, run this shell command before signalling COMMAND (TIMEOUT_PID, TIMEOUT_PGID and TIMEOUT_ELAPSED are set)")
+	onTimeoutLimit = flag.String("on-timeout-limit", "", "kill the --on-timeout command after this long (default 30s)")
+	onExit         = flag.String("on-exit", "", "run this shell command after COMMAND has exited (TIMEOUT_EXIT_CODE, TIMEOUT_REASON, TIMEOUT_DURATION and TIMEOUT_REPORT_PATH are set)")
+	onExitStrict   = flag.Bool("on-exit-strict", false, "exit with status 125 if the --on-exit command fails and COMMAND succeeded")
+	tailOnTimeout  = flag.String("tail-on-timeout", "", "on timeout, print the last N lines of COMMAND's stdout and stderr to stderr")
+
+	timeoutExitCode = flag.String("timeout-exit-code", "", "exit with status N instead of 124 when COMMAND times out")
+	killExitCode    = flag.String("kill-exit-code", "", "exit with status N when COMMAND had to be killed with KILL on timeout")
+	mapExit         = flag.String("map-exit", "", "replace exit statuses by FROM:TO rules separated by commas, e.g. 124:75,137:75")
+
+	scale       = flag.String("scale", "", "multiply every duration by FACTOR, for slow environments")
+	profile     = flag.String("profile", "", "apply the named profile from the configuration file")
+	printConfig = flag.Bool("print-config", false, "print the effective settings and exit")
+
+	parallel = flag.Bool("parallel", false, "run several COMMANDs separated by ':::' at once")
+	deadline = flag.String("deadline", "", "with --parallel, stop every command still running after DURATION")
+	failFast = flag.Bool("fail-fast", false, "with --parallel, stop the other commands once one fails")
+	pty      = flag.Bool("pty", false, "run COMMAND on a pseudo-terminal and signal its whole process group")
+
+	logFormat = flag.String("log-format", "", "format of timeout's own log: text (default), json or logfmt")
+	logLevel  = flag.String("log-level", "", "least severe events to log: debug, info, warn or error (default: warn, or info with --verbose)")
+	logFile   = flag.String("log-file", "", "append timeout's own log to FILE instead of stderr")
+
+	timestamps   = optionalString{value: "", implicit: TimestampsRFC3339}
+	syslogOption = optionalString{value: "", implicit: "user"}
+	outputPrefix = flag.String("prefix", "", "write STR in front of every line of COMMAND's output")
+
+	stdoutFile   = flag.String("stdout-file", "", "write COMMAND's stdout to FILE instead of stdout")
+	stderrFile   = flag.String("stderr-file", "", "write COMMAND's stderr to FILE instead of stderr")
+	combinedFile = flag.String("combined-file", "", "write COMMAND's stdout and stderr to FILE")
+	teeOutput    = flag.Bool("tee", false, "with a log file, also pass COMMAND's output through to stdout and stderr")
+	maxLogSize   = flag.String("max-log-size", "", "compress log files to FILE.N.gz once they would grow past SIZE, keeping 5")
+
+	stdinMode    = flag.String("stdin", "", "where COMMAND's stdin comes from: inherit (default), null, close or a FILE")
+	stdinTimeout = flag.String("stdin-timeout", "", "stop COMMAND as on timeout once it has waited this long for input from the terminal")
+
+	maxOutput       = flag.String("max-output", "", "stop COMMAND as on timeout once it has written more than SIZE bytes of output")
+	maxOutputAction = flag.String("max-output-action", "", "what to do past --max-output: kill (default) or truncate the output")
 )
 
+// stringList is a flag.Value collecting every occurrence of a repeatable flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// optionalString is a flag.Value that may be given without a value, as in
+// --timestamps, taking its implicit value, or with one, as in
+// --timestamps=elapsed
+type optionalString struct {
+	value    string
+	implicit string
+}
+
+func (o *optionalString) String() string {
+	return o.value
+}
+
+func (o *optionalString) Set(value string) error {
+	switch value {
+	case "true":
+		o.value = o.implicit
+	case "false":
+		o.value = ""
+	default:
+		o.value = value
+	}
+	return nil
+}
+
+func (o *optionalString) IsBoolFlag() bool {
+	return true
+}
+
+func init() {
+	flag.Var(&timestamps, "timestamps", "write a timestamp in front of every line of COMMAND's output; FORMAT is rfc3339 (default) or elapsed")
+	flag.Var(&syslogOption, "syslog", "also send timeout's events to journald or syslog, under FACILITY (default user)")
+	flag.Var(&metricsLabels, "metrics-label", "add the label NAME=VALUE to the --metrics-file and --statsd metrics (repeatable)")
+	flag.Var(&killOnOutput, "kill-on-output", "signal COMMAND as on timeout once a line of its output matches [stdout:|stderr:]REGEX (repeatable)")
+}
+
 func main() {
 	flag.Usage = func() { usage(os.Stderr, os.Args[0]) }
 	flag.Parse()
 
+	if err := applyEnv(flag.CommandLine, os.LookupEnv); err != nil {
+		fmt.Fprintf(os.Stderr, "timeout: %v\n", err)
+		os.Exit(125)
+	}
+
+	if err := loadConfig(flag.CommandLine, *profile); err != nil {
+		fmt.Fprintf(os.Stderr, "timeout: %v\n", err)
+		os.Exit(125)
+	}
+
+	if *printConfig {
+		writeEffectiveConfig(os.Stdout, flag.CommandLine)
+		os.Exit(0)
+	}
+
 	config := Config{
 		KillAfter:      *killAfter,
 		SignalName:     *signalName,
@@ -308,9 +1421,63 @@ func main() {
 		Verbose:        *verbose,
 		Help:           *help,
 		Version:        *version,
-		Stdout:         os.Stdout,
-		Stderr:         os.Stderr,
-		Stdin:          os.Stdin,
+
+		ReadyTimeout:     *readyTimeout,
+		ReadyTCP:         *readyTCP,
+		ReadyFile:        *readyFile,
+		ReadyStdoutRegex: *readyStdoutRegex,
+		ReadyCmd:         *readyCmd,
+
+		KillOnOutput:   killOnOutput,
+		MetricsFile:    *metricsFile,
+		StatsD:         *statsd,
+		NotifyURL:      *notifyURL,
+		NotifyTemplate: *notifyTemplate,
+		MetricsLabels:  metricsLabels,
+		Report:         *report,
+		TailOnTimeout:  *tailOnTimeout,
+		DumpSignal:     *dumpSignal,
+		DumpWait:       *dumpWait,
+		DumpFile:       *dumpFile,
+		OnTimeout:      *onTimeout,
+		OnTimeoutLimit: *onTimeoutLimit,
+		OnExit:         *onExit,
+		OnExitStrict:   *onExitStrict,
+
+		TimeoutExitCode: *timeoutExitCode,
+		KillExitCode:    *killExitCode,
+		MapExit:         *mapExit,
+
+		Scale: *scale,
+
+		Parallel: *parallel,
+		Deadline: *deadline,
+		FailFast: *failFast,
+		Pty:      *pty,
+
+		LogFormat: *logFormat,
+		LogLevel:  *logLevel,
+		LogFile:   *logFile,
+		Syslog:    syslogOption.value,
+
+		Timestamps: timestamps.value,
+		Prefix:     *outputPrefix,
+
+		StdoutFile:   *stdoutFile,
+		StderrFile:   *stderrFile,
+		CombinedFile: *combinedFile,
+		Tee:          *teeOutput,
+		MaxLogSize:   *maxLogSize,
+
+		MaxOutput:       *maxOutput,
+		MaxOutputAction: *maxOutputAction,
+
+		StdinMode:    *stdinMode,
+		StdinTimeout: *stdinTimeout,
+
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+		Stdin:  os.Stdin,
 	}
 
 	result := runTimeout(config, flag.Args())
@@ -7,6 +7,7 @@ package main
 import (
 	"bytes"
 	"io"
+	"math"
 	"os"
 	"strings"
 	"sync"
@@ -91,12 +92,12 @@ func TestParseDuration(t *testing.T) {
 		{"0", 0, false},
 		{"0s", 0, false},
 
-		// Invalid cases (but some are actually valid in GNU timeout)
+		// Invalid cases
 		{"", 0, true},
 		{"abc", 0, true},
 		{"30x", 0, true},
-		// Note: "-5" is actually parsed as -5 seconds by strconv.ParseFloat
-		// GNU timeout allows negative durations (they're treated as 0)
+		{"-5", 0, true},
+		{"nan", 0, true},
 		{"30.5.5", 0, true},
 	}
 
@@ -183,6 +184,24 @@ func TestParseSignal(t *testing.T) {
 	}
 }
 
+func TestFormatSignal(t *testing.T) {
+	tests := []struct {
+		input    syscall.Signal
+		expected string
+	}{
+		{syscall.SIGTERM, "TERM"},
+		{syscall.SIGKILL, "KILL"},
+		{syscall.SIGUSR1, "USR1"},
+		{syscall.Signal(64), "64"},
+	}
+
+	for _, test := range tests {
+		if result := formatSignal(test.input); result != test.expected {
+			t.Errorf("For signal %d, expected %q, got %q", int(test.input), test.expected, result)
+		}
+	}
+}
+
 func TestParseDurationEdgeCases(t *testing.T) {
 	// Test floating point precision
 	result, err := parseDuration("0.001s")
@@ -205,6 +224,134 @@ func TestParseDurationEdgeCases(t *testing.T) {
 	}
 }
 
+func TestScaleDuration(t *testing.T) {
+	tests := []struct {
+		input    time.Duration
+		scale    float64
+		expected time.Duration
+	}{
+		{30 * time.Second, 1, 30 * time.Second},
+		{30 * time.Second, 4, 2 * time.Minute},
+		{30 * time.Second, 0.5, 15 * time.Second},
+		{0, 10, 0},
+		{365 * 24 * time.Hour, 1e9, time.Duration(math.MaxInt64)},
+	}
+
+	for _, test := range tests {
+		if result := scaleDuration(test.input, test.scale); result != test.expected {
+			t.Errorf("For %v x%v, expected %v, got %v", test.input, test.scale, test.expected, result)
+		}
+	}
+}
+
+func TestRunTimeoutScale(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName: "TERM",
+		Scale:      "10",
+		Stdout:     &stdout,
+		Stderr:     &stderr,
+	}
+
+	// 0.05s scaled by 10 leaves enough time for the command to finish
+	result := runTimeout(config, []string{"0.05s", "sleep", "0.2"})
+
+	if result.ExitCode != 0 {
+		t.Errorf("Expected exit code 0 with scaled timeout, got %d", result.ExitCode)
+	}
+}
+
+func TestParseScale(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+		hasError bool
+	}{
+		{"", 1, false},
+		{"4", 4, false},
+		{"0.5", 0.5, false},
+		{"1e1", 10, false},
+
+		{"fast", 0, true},
+		{"0", 0, true},
+		{"-2", 0, true},
+		{"NaN", 0, true},
+		{"Inf", 0, true},
+		{"+inf", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			result, err := parseScale(test.input)
+
+			if test.hasError {
+				if err == nil {
+					t.Errorf("Expected error for input %q, but got none", test.input)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Unexpected error for input %q: %v", test.input, err)
+				return
+			}
+
+			if result != test.expected {
+				t.Errorf("For input %q, expected %v, got %v", test.input, test.expected, result)
+			}
+		})
+	}
+}
+
+func TestRunTimeoutScaleVerbose(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName: "TERM",
+		KillAfter:  "5",
+		Scale:      "4",
+		Verbose:    true,
+		Stdout:     &stdout,
+		Stderr:     &stderr,
+	}
+
+	result := runTimeout(config, []string{"30s", "true"})
+
+	if result.ExitCode != 0 {
+		t.Errorf("Expected exit code 0, got %d", result.ExitCode)
+	}
+
+	output := stderr.String()
+	for _, expected := range []string{"duration 30s \u00d74 = 2m0s", "kill-after 5s \u00d74 = 20s"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Verbose output missing %q, got %q", expected, output)
+		}
+	}
+	if strings.Contains(output, "on-timeout-limit") {
+		t.Errorf("Unused durations should not be reported, got %q", output)
+	}
+}
+
+func TestRunTimeoutInvalidScale(t *testing.T) {
+	for _, scale := range []string{"fast", "0", "-2", "NaN"} {
+		var stdout, stderr SafeBuffer
+		config := Config{
+			SignalName: "TERM",
+			Scale:      scale,
+			Stdout:     &stdout,
+			Stderr:     &stderr,
+		}
+
+		result := runTimeout(config, []string{"5s", "true"})
+
+		if result.ExitCode != 125 {
+			t.Errorf("Expected exit code 125 for scale %q, got %d", scale, result.ExitCode)
+		}
+		if !strings.Contains(stderr.String(), "invalid scale factor") {
+			t.Errorf("Expected scale error message, got %q", stderr.String())
+		}
+	}
+}
+
 func TestParseSignalCaseInsensitive(t *testing.T) {
 	tests := []string{"term", "TERM", "Term", "TeRm"}
 
@@ -222,14 +369,106 @@ func TestParseSignalCaseInsensitive(t *testing.T) {
 }
 
 func TestParseDurationNegative(t *testing.T) {
-	// Test that negative durations are parsed (GNU timeout behavior)
-	result, err := parseDuration("-5")
-	if err != nil {
-		t.Errorf("Unexpected error for negative duration: %v", err)
+	// Test that negative durations are rejected (GNU timeout behavior)
+	for _, input := range []string{"-5", "-0.5s", "-1h30m", "-inf"} {
+		_, err := parseDuration(input)
+		if err == nil || err.Error() != "negative duration" {
+			t.Errorf("Expected negative duration error for %q, got %v", input, err)
+		}
 	}
-	expected := -5 * time.Second
-	if result != expected {
-		t.Errorf("Expected %v, got %v", expected, result)
+}
+
+func TestParseDurationGrammar(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+	}{
+		// Go-style compound durations and sub-second units
+		{"1h30m", 90 * time.Minute},
+		{"1d12h", 36 * time.Hour},
+		{"500ms", 500 * time.Millisecond},
+		{"2.5us", 2500 * time.Nanosecond},
+		{"2.5µs", 2500 * time.Nanosecond},
+		{"2.5μs", 2500 * time.Nanosecond},
+		{"10ns", 10 * time.Nanosecond},
+		{"1m30.5s", 90500 * time.Millisecond},
+		{"1h 30m", 90 * time.Minute},
+
+		// Whitespace and signs
+		{" 30s ", 30 * time.Second},
+		{"\t5m\n", 5 * time.Minute},
+		{"+5", 5 * time.Second},
+
+		// Exponents and hexadecimal floats
+		{"1e3", 1000 * time.Second},
+		{"1.5e-3s", 1500 * time.Microsecond},
+		{"0x1p3", 8 * time.Second},
+		{"0x1.8p1m", 3 * time.Minute},
+		{"0x10", 16 * time.Second},
+		{"0x1d", 29 * time.Second}, // d is a hex digit, as with strtod
+
+		// Infinity means no timeout
+		{"inf", 0},
+		{"INF", 0},
+		{"infinity", 0},
+		{"+Infinity", 0},
+
+		// Range handling
+		{"1e20d", time.Duration(math.MaxInt64)},
+		{"1e400", time.Duration(math.MaxInt64)},
+		{"3000000h", time.Duration(math.MaxInt64)},
+		{"1e-12", time.Nanosecond},
+		{"0.0", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			result, err := parseDuration(test.input)
+			if err != nil {
+				t.Errorf("Unexpected error for input %q: %v", test.input, err)
+				return
+			}
+			if result != test.expected {
+				t.Errorf("For input %q, expected %v, got %v", test.input, test.expected, result)
+			}
+		})
+	}
+}
+
+func TestParseDurationErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", "empty duration"},
+		{"   ", "empty duration"},
+		{"nan", "NaN is not a valid duration"},
+		{"NaN", "NaN is not a valid duration"},
+		{"-5s", "negative duration"},
+		{"abc", "expected a number at 'abc'"},
+		{"s", "expected a number at 's'"},
+		{"30x", "unknown unit 'x'"},
+		{"5sec", "unknown unit 'sec'"},
+		{"1h30", "missing unit after '30'"},
+		{"1 30", "missing unit after '1'"},
+		{"30.5.5", "unexpected '.5' after '30.5'"},
+		{"5%", "unexpected '%' after '5'"},
+		{"0x", "invalid hexadecimal number '0x'"},
+		{"0x1p", "invalid exponent in '0x1p'"},
+		{"1h-30m", "expected a number at '-30m'"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			_, err := parseDuration(test.input)
+			if err == nil {
+				t.Errorf("Expected error for input %q, but got none", test.input)
+				return
+			}
+			if err.Error() != test.expected {
+				t.Errorf("For input %q, expected error %q, got %q", test.input, test.expected, err)
+			}
+		})
 	}
 }
 
@@ -454,28 +693,190 @@ func TestRunTimeoutCommandWithExitCode(t *testing.T) {
 	}
 }
 
-// Test timeout with fast command to ensure we test timeout code path
+// runFake runs runTimeout against a fake clock and process in the
+// background, returning the channel its Result is delivered on
+func runFake(config Config, clock *fakeClock, proc *fakeProcess, args []string) <-chan Result {
+	config.Clock = clock
+	config.Starter = &fakeStarter{proc: proc}
+	results := make(chan Result, 1)
+	go func() {
+		results <- runTimeout(config, args)
+	}()
+	return results
+}
+
+// waitResult waits for runFake to finish, failing the test if it hangs
+func waitResult(t *testing.T, results <-chan Result) Result {
+	t.Helper()
+	select {
+	case result := <-results:
+		return result
+	case <-time.After(5 * time.Second):
+		t.Fatalf("runTimeout did not return")
+		return Result{}
+	}
+}
+
 func TestRunTimeoutActualTimeout(t *testing.T) {
-	// Skip this test for now as it's flaky in test environment
-	t.Skip("Timeout tests are flaky in test environment - manual testing shows they work")
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", Stdout: &stdout, Stderr: &stderr}
+	clock := newFakeClock()
+	proc := newFakeProcess(exitOn(-1, syscall.SIGTERM))
+
+	results := runFake(config, clock, proc, []string{"10s", "server"})
+	clock.WaitForTimers(t, 1)
+
+	clock.Advance(9 * time.Second)
+	proc.mu.Lock()
+	early := len(proc.signals)
+	proc.mu.Unlock()
+	if early != 0 {
+		t.Errorf("No signal should be sent before the timeout, got %d", early)
+	}
+
+	clock.Advance(time.Second)
+	result := waitResult(t, results)
+
+	if result.ExitCode != 124 {
+		t.Errorf("Expected exit code 124, got %d", result.ExitCode)
+	}
+	if result.Reason != ReasonTimeout {
+		t.Errorf("Expected reason %q, got %q", ReasonTimeout, result.Reason)
+	}
+	if strings.Join(result.Signals, ",") != "TERM" {
+		t.Errorf("Expected signals [TERM], got %v", result.Signals)
+	}
+	if result.Elapsed != 10*time.Second {
+		t.Errorf("Expected elapsed 10s, got %v", result.Elapsed)
+	}
 }
 
-// Test kill-after functionality
-func TestRunTimeoutKillAfterSkip(t *testing.T) {
-	// Skip this test for now as it's flaky in test environment
-	t.Skip("Kill-after tests are flaky in test environment - manual testing shows they work")
+func TestRunTimeoutKillAfterEscalation(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", KillAfter: "5s", Verbose: true, Stdout: &stdout, Stderr: &stderr}
+	clock := newFakeClock()
+
+	// The command ignores TERM and only dies from KILL
+	proc := newFakeProcess(exitOn(-1, syscall.SIGKILL))
+
+	results := runFake(config, clock, proc, []string{"10s", "server"})
+	clock.WaitForTimers(t, 1)
+	clock.Advance(10 * time.Second)
+
+	// Wait for the kill-after timer started once TERM was sent
+	clock.WaitForTimers(t, 1)
+	clock.Advance(5 * time.Second)
+	result := waitResult(t, results)
+
+	if result.ExitCode != 124 {
+		t.Errorf("Expected exit code 124, got %d", result.ExitCode)
+	}
+	if strings.Join(result.Signals, ",") != "TERM,KILL" {
+		t.Errorf("Expected signals [TERM KILL], got %v", result.Signals)
+	}
+	if result.Elapsed != 15*time.Second {
+		t.Errorf("Expected elapsed 15s, got %v", result.Elapsed)
+	}
+	if !strings.Contains(stderr.String(), "sending signal KILL to command 'server'") {
+		t.Errorf("Verbose output should report the KILL, got %q", stderr.String())
+	}
+}
+
+func TestRunTimeoutExitBeforeKillAfter(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", KillAfter: "5s", Stdout: &stdout, Stderr: &stderr}
+	clock := newFakeClock()
+	proc := newFakeProcess(exitOn(143, syscall.SIGTERM))
+
+	results := runFake(config, clock, proc, []string{"10s", "server"})
+	clock.WaitForTimers(t, 1)
+	clock.Advance(10 * time.Second)
+	result := waitResult(t, results)
+
+	if result.ExitCode != 124 {
+		t.Errorf("Expected exit code 124, got %d", result.ExitCode)
+	}
+	if strings.Join(result.Signals, ",") != "TERM" {
+		t.Errorf("KILL should not be sent once the command exited, got %v", result.Signals)
+	}
 }
 
-// Test preserve status functionality
-func TestRunTimeoutPreserveStatusSkip(t *testing.T) {
-	// Skip this test for now as it's flaky in test environment
-	t.Skip("Preserve status timeout tests are flaky in test environment")
+func TestRunTimeoutPreserveStatusOnTimeout(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", PreserveStatus: true, Stdout: &stdout, Stderr: &stderr}
+	clock := newFakeClock()
+	proc := newFakeProcess(exitOn(42, syscall.SIGTERM))
+
+	results := runFake(config, clock, proc, []string{"1s", "server"})
+	clock.WaitForTimers(t, 1)
+	clock.Advance(time.Second)
+	result := waitResult(t, results)
+
+	if result.ExitCode != 42 {
+		t.Errorf("Expected the command's exit code 42, got %d", result.ExitCode)
+	}
+	if result.Reason != ReasonTimeout {
+		t.Errorf("Expected reason %q, got %q", ReasonTimeout, result.Reason)
+	}
 }
 
-// Test KILL signal timeout
-func TestRunTimeoutKillSignalSkip(t *testing.T) {
-	// Skip this test for now as it's flaky in test environment
-	t.Skip("KILL signal timeout tests are flaky in test environment")
+func TestRunTimeoutKillSignal(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "KILL", Stdout: &stdout, Stderr: &stderr}
+	clock := newFakeClock()
+	proc := newFakeProcess(exitOn(-1, syscall.SIGKILL))
+
+	results := runFake(config, clock, proc, []string{"1s", "server"})
+	clock.WaitForTimers(t, 1)
+	clock.Advance(time.Second)
+	result := waitResult(t, results)
+
+	if result.ExitCode != 137 {
+		t.Errorf("Expected exit code 137, got %d", result.ExitCode)
+	}
+	if strings.Join(result.Signals, ",") != "KILL" {
+		t.Errorf("Expected signals [KILL], got %v", result.Signals)
+	}
+}
+
+func TestRunTimeoutInterrupted(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	interrupts := make(chan os.Signal, 1)
+	config := Config{SignalName: "TERM", Interrupts: interrupts, Stdout: &stdout, Stderr: &stderr}
+	clock := newFakeClock()
+	proc := newFakeProcess(exitOn(-1, os.Interrupt))
+
+	results := runFake(config, clock, proc, []string{"10s", "server"})
+	clock.WaitForTimers(t, 1)
+	interrupts <- os.Interrupt
+	result := waitResult(t, results)
+
+	if result.ExitCode != 130 {
+		t.Errorf("Expected exit code 130, got %d", result.ExitCode)
+	}
+	if result.Reason != ReasonSignal {
+		t.Errorf("Expected reason %q, got %q", ReasonSignal, result.Reason)
+	}
+	if strings.Join(result.Signals, ",") != "INT" {
+		t.Errorf("Expected the interrupt to be forwarded, got %v", result.Signals)
+	}
+}
+
+func TestRunTimeoutStartError(t *testing.T) {
+	var stdout, stderr SafeBuffer
+	config := Config{
+		SignalName: "TERM",
+		Clock:      newFakeClock(),
+		Starter:    &fakeStarter{err: os.ErrPermission},
+		Stdout:     &stdout,
+		Stderr:     &stderr,
+	}
+
+	result := runTimeout(config, []string{"10s", "server"})
+
+	if result.ExitCode != 1 || result.Reason != ReasonError {
+		t.Errorf("Expected exit code 1 with reason %q, got %d %q", ReasonError, result.ExitCode, result.Reason)
+	}
 }
 
 func TestRunTimeoutProcessNil(t *testing.T) {
@@ -679,7 +1080,7 @@ func TestRunTimeoutGeneralCommandError(t *testing.T) {
 		t.Errorf("Expected error to be set for failed command")
 	}
 
-	if !strings.Contains(stderr.String(), "Error starting command") {
+	if !strings.Contains(stderr.String(), "timeout: failed to run command 'this-command-definitely-does-not-exist-anywhere'") {
 		t.Errorf("Expected error message about starting command")
 	}
 }
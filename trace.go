@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultOTLPEndpoint is the collector used when tracing is enabled with
+// OTEL_TRACES_EXPORTER=otlp but no endpoint is set
+const defaultOTLPEndpoint = "http://localhost:4318"
+
+// defaultOTLPTimeout bounds the export when OTEL_EXPORTER_OTLP_TIMEOUT is
+// not set
+const defaultOTLPTimeout = 10 * time.Second
+
+// OTLP span kind and status codes
+const (
+	spanKindInternal = 1
+	statusOK         = 1
+	statusError      = 2
+)
+
+// tracer exports a span for each run to an OTLP/HTTP collector as JSON
+type tracer struct {
+	endpoint string
+	headers  map[string]string
+	timeout  time.Duration
+	resource []otlpAttribute
+
+	traceID  string
+	spanID   string
+	parentID string
+	sampled  bool
+}
+
+// newTracer configures tracing from the standard OTEL_* environment
+// variables. It returns nil when tracing is not enabled.
+func newTracer() (*tracer, error) {
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") {
+		return nil, nil
+	}
+
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	exporters := os.Getenv("OTEL_TRACES_EXPORTER")
+	if exporters != "" && !containsItem(exporters, "otlp") {
+		return nil, nil
+	}
+	if endpoint == "" {
+		if exporters == "" {
+			return nil, nil
+		}
+		endpoint = defaultOTLPEndpoint + "/v1/traces"
+	}
+	if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid OTLP endpoint '%s'", endpoint)
+	}
+
+	protocol := otelEnv("PROTOCOL")
+	if protocol != "" && protocol != "http/json" {
+		return nil, fmt.Errorf("unsupported OTLP protocol '%s': only http/json is supported", protocol)
+	}
+
+	t := &tracer{endpoint: endpoint, timeout: defaultOTLPTimeout, sampled: true}
+
+	var err error
+	if t.headers, err = parseOTELList(otelEnv("HEADERS")); err != nil {
+		return nil, fmt.Errorf("invalid OTLP headers: %v", err)
+	}
+	if s := otelEnv("TIMEOUT"); s != "" {
+		ms, err := strconv.Atoi(s)
+		if err != nil || ms < 0 {
+			return nil, fmt.Errorf("invalid OTLP timeout '%s'", s)
+		}
+		t.timeout = time.Duration(ms) * time.Millisecond
+	}
+
+	resource, err := parseOTELList(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTEL_RESOURCE_ATTRIBUTES: %v", err)
+	}
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		resource["service.name"] = name
+	} else if resource["service.name"] == "" {
+		resource["service.name"] = "timeout"
+	}
+	keys := make([]string, 0, len(resource))
+	for key := range resource {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		t.resource = append(t.resource, stringAttr(key, resource[key]))
+	}
+
+	// Join the trace of the caller, if any
+	if traceID, parentID, flags, ok := parseTraceparent(os.Getenv("TRACEPARENT")); ok {
+		t.traceID, t.parentID = traceID, parentID
+		t.sampled = flags&1 == 1
+	} else {
+		t.traceID = randomID(16)
+	}
+	t.spanID = randomID(8)
+	return t, nil
+}
+
+// otelEnv returns the traces-specific OTEL_EXPORTER_OTLP_TRACES_NAME
+// variable, falling back to OTEL_EXPORTER_OTLP_NAME
+func otelEnv(name string) string {
+	if value := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_" + name); value != "" {
+		return value
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_" + name)
+}
+
+// containsItem reports whether the comma-separated list s contains item
+func containsItem(s, item string) bool {
+	for _, v := range strings.Split(s, ",") {
+		if strings.TrimSpace(v) == item {
+			return true
+		}
+	}
+	return false
+}
+
+// parseOTELList parses a "key1=value1,key2=value2" list with
+// percent-encoded values
+func parseOTELList(s string) (map[string]string, error) {
+	m := map[string]string{}
+	for _, item := range strings.Split(s, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("'%s' is not KEY=VALUE", item)
+		}
+		value, err := url.PathUnescape(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("'%s': %v", item, err)
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+// parseTraceparent parses a W3C traceparent header value
+func parseTraceparent(s string) (traceID, parentID string, flags byte, ok bool) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return "", "", 0, false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return "", "", 0, false
+	}
+	for _, p := range parts[:4] {
+		if _, err := hex.DecodeString(p); err != nil || p != strings.ToLower(p) {
+			return "", "", 0, false
+		}
+	}
+	if strings.Trim(parts[1], "0") == "" || strings.Trim(parts[2], "0") == "" {
+		return "", "", 0, false
+	}
+	f, _ := hex.DecodeString(parts[3])
+	return parts[1], parts[2], f[0], true
+}
+
+// randomID returns n random bytes in hex
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// traceparent is the TRACEPARENT passed to the command, naming the run's
+// span as its parent
+func (t *tracer) traceparent() string {
+	flags := "00"
+	if t.sampled {
+		flags = "01"
+	}
+	return "00-" + t.traceID + "-" + t.spanID + "-" + flags
+}
+
+// export sends the span of the run of command, and one child span for each
+// command it ran with --parallel or run-steps
+func (t *tracer) export(command []string, result Result, now time.Time) error {
+	if !t.sampled {
+		return nil
+	}
+
+	spans := []otlpSpan{t.span(t.spanID, t.parentID, command, result, now)}
+	for _, r := range result.Commands {
+		if r.Start.IsZero() {
+			continue // skipped step
+		}
+		spans = append(spans, t.span(randomID(8), t.spanID, r.Command, r, now))
+	}
+
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: t.resource},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "timeout", Version: Version},
+			Spans: spans,
+		}},
+	}}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cannot export trace: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+
+	client := &http.Client{Timeout: t.timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot export trace: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("cannot export trace: collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// span describes the run of command that produced result
+func (t *tracer) span(spanID, parentID string, command []string, result Result, now time.Time) otlpSpan {
+	start := result.Start
+	if start.IsZero() {
+		start = now // the command never started
+	}
+
+	name := "timeout"
+	if result.Name != "" {
+		name = result.Name
+	} else if len(command) > 0 {
+		name = filepath.Base(command[0])
+	}
+
+	s := otlpSpan{
+		TraceID:      t.traceID,
+		SpanID:       spanID,
+		ParentSpanID: parentID,
+		Name:         name,
+		Kind:         spanKindInternal,
+		Start:        strconv.FormatInt(start.UnixNano(), 10),
+		End:          strconv.FormatInt(start.Add(result.Elapsed).UnixNano(), 10),
+		Attributes: []otlpAttribute{
+			arrayAttr("process.command_args", command),
+			intAttr("process.exit.code", result.ExitCode),
+			stringAttr("timeout.reason", result.Reason),
+			doubleAttr("timeout.limit_seconds", result.Limit.Seconds()),
+		},
+		Status: otlpStatus{Code: statusOK},
+	}
+	if result.Matched != "" {
+		s.Attributes = append(s.Attributes, stringAttr("timeout.matched_line", result.Matched))
+	}
+	for i, sig := range result.Signals {
+		at := start
+		if i < len(result.SignalTimes) {
+			at = result.SignalTimes[i]
+		}
+		s.Events = append(s.Events, otlpEvent{
+			Time:       strconv.FormatInt(at.UnixNano(), 10),
+			Name:       "signal",
+			Attributes: []otlpAttribute{stringAttr("signal", sig)},
+		})
+	}
+
+	if result.ExitCode != 0 {
+		s.Status.Code = statusError
+		switch {
+		case result.Error != nil:
+			s.Status.Message = result.Error.Error()
+		case result.Reason != "" && result.Reason != ReasonCompleted:
+			s.Status.Message = result.Reason
+		default:
+			s.Status.Message = fmt.Sprintf("exit status %d", result.ExitCode)
+		}
+	}
+	return s
+}
+
+// The OTLP/JSON trace export request
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpSpan struct {
+	TraceID      string          `json:"traceId"`
+	SpanID       string          `json:"spanId"`
+	ParentSpanID string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         int             `json:"kind"`
+	Start        string          `json:"startTimeUnixNano"`
+	End          string          `json:"endTimeUnixNano"`
+	Attributes   []otlpAttribute `json:"attributes"`
+	Events       []otlpEvent     `json:"events,omitempty"`
+	Status       otlpStatus      `json:"status"`
+}
+
+type otlpEvent struct {
+	Time       string          `json:"timeUnixNano"`
+	Name       string          `json:"name"`
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+func stringAttr(key, value string) otlpAttribute {
+	return otlpAttribute{key, map[string]any{"stringValue": value}}
+}
+
+// intAttr encodes value as a string, as OTLP/JSON does for 64-bit integers
+func intAttr(key string, value int) otlpAttribute {
+	return otlpAttribute{key, map[string]any{"intValue": strconv.Itoa(value)}}
+}
+
+func doubleAttr(key string, value float64) otlpAttribute {
+	return otlpAttribute{key, map[string]any{"doubleValue": value}}
+}
+
+func arrayAttr(key string, values []string) otlpAttribute {
+	items := make([]map[string]any, len(values))
+	for i, v := range values {
+		items[i] = map[string]any{"stringValue": v}
+	}
+	return otlpAttribute{key, map[string]any{"arrayValue": map[string]any{"values": items}}}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// collector is a stand-in OTLP/HTTP collector recording the requests it gets
+type collector struct {
+	server   *httptest.Server
+	requests chan collected
+}
+
+type collected struct {
+	header http.Header
+	body   otlpRequest
+}
+
+func newCollector(t *testing.T, status int) *collector {
+	c := &collector{requests: make(chan collected, 10)}
+	c.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		var body otlpRequest
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("Collector got invalid JSON: %v", err)
+		}
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("Expected a request to /v1/traces, got %s", r.URL.Path)
+		}
+		c.requests <- collected{r.Header, body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(c.server.Close)
+	return c
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		valid  bool
+		flags  byte
+		parent string
+	}{
+		{"sampled", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", true, 1, "b7ad6b7169203331"},
+		{"not sampled", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00", true, 0, "b7ad6b7169203331"},
+		{"future version", "01-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-extra", true, 1, "b7ad6b7169203331"},
+		{"empty", "", false, 0, ""},
+		{"zero trace", "00-00000000000000000000000000000000-b7ad6b7169203331-01", false, 0, ""},
+		{"zero parent", "00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01", false, 0, ""},
+		{"uppercase", "00-0AF7651916CD43DD8448EB211C80319C-b7ad6b7169203331-01", false, 0, ""},
+		{"version ff", "ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", false, 0, ""},
+		{"extra field", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-extra", false, 0, ""},
+		{"short", "00-0af7651916cd43dd-b7ad6b7169203331-01", false, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, parent, flags, ok := parseTraceparent(tt.value)
+			if ok != tt.valid {
+				t.Fatalf("Expected valid=%v for %q, got %v", tt.valid, tt.value, ok)
+			}
+			if ok && (parent != tt.parent || flags != tt.flags) {
+				t.Errorf("Expected parent %s flags %d, got %s %d", tt.parent, tt.flags, parent, flags)
+			}
+		})
+	}
+}
+
+func TestNewTracer(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		endpoint string
+		hasError bool
+	}{
+		{"not configured", map[string]string{}, "", false},
+		{"endpoint", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318/"}, "http://collector:4318/v1/traces", false},
+		{"traces endpoint", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://a:4318", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://b/traces"}, "http://b/traces", false},
+		{"exporter only", map[string]string{"OTEL_TRACES_EXPORTER": "otlp"}, "http://localhost:4318/v1/traces", false},
+		{"exporter none", map[string]string{"OTEL_TRACES_EXPORTER": "none", "OTEL_EXPORTER_OTLP_ENDPOINT": "http://a:4318"}, "", false},
+		{"disabled", map[string]string{"OTEL_SDK_DISABLED": "true", "OTEL_EXPORTER_OTLP_ENDPOINT": "http://a:4318"}, "", false},
+		{"json protocol", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://a:4318", "OTEL_EXPORTER_OTLP_PROTOCOL": "http/json"}, "http://a:4318/v1/traces", false},
+		{"protobuf protocol", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://a:4318", "OTEL_EXPORTER_OTLP_PROTOCOL": "http/protobuf"}, "", true},
+		{"invalid endpoint", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "collector:4318"}, "", true},
+		{"invalid headers", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://a:4318", "OTEL_EXPORTER_OTLP_HEADERS": "token"}, "", true},
+		{"invalid timeout", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://a:4318", "OTEL_EXPORTER_OTLP_TIMEOUT": "5s"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"OTEL_SDK_DISABLED", "OTEL_TRACES_EXPORTER", "OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_EXPORTER_OTLP_PROTOCOL", "OTEL_EXPORTER_OTLP_HEADERS", "OTEL_EXPORTER_OTLP_TIMEOUT"} {
+				t.Setenv(name, tt.env[name])
+			}
+
+			trace, err := newTracer()
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("Expected error for %v", tt.env)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tt.endpoint == "" {
+				if trace != nil {
+					t.Errorf("Expected tracing to be off, got endpoint %s", trace.endpoint)
+				}
+				return
+			}
+			if trace == nil || trace.endpoint != tt.endpoint {
+				t.Errorf("Expected endpoint %s, got %v", tt.endpoint, trace)
+			}
+		})
+	}
+}
+
+func TestRunTimeoutTraceExport(t *testing.T) {
+	c := newCollector(t, http.StatusOK)
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", c.server.URL)
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "authorization=Bearer%20secret")
+	t.Setenv("OTEL_SERVICE_NAME", "ci")
+	t.Setenv("TRACEPARENT", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", Stdout: &stdout, Stderr: &stderr}
+	clock := newFakeClock()
+	starter := &fakeStarter{proc: newFakeProcess(exitOn(-1, syscall.SIGTERM))}
+	config.Clock = clock
+	config.Starter = starter
+
+	results := make(chan Result, 1)
+	go func() {
+		results <- runTimeout(config, []string{"10s", "make", "test"})
+	}()
+	clock.WaitForTimers(t, 1)
+	start := clock.Now()
+	clock.Advance(10 * time.Second)
+	result := waitResult(t, results)
+
+	if result.ExitCode != 124 {
+		t.Errorf("Expected exit code 124, got %d", result.ExitCode)
+	}
+
+	var req collected
+	select {
+	case req = <-c.requests:
+	default:
+		t.Fatalf("Expected the span to be exported")
+	}
+	if req.header.Get("Authorization") != "Bearer secret" {
+		t.Errorf("Expected the OTLP headers to be sent, got %q", req.header.Get("Authorization"))
+	}
+	resource := req.body.ResourceSpans[0].Resource.Attributes
+	if len(resource) != 1 || resource[0].Key != "service.name" || resource[0].Value["stringValue"] != "ci" {
+		t.Errorf("Expected service.name ci, got %v", resource)
+	}
+
+	span := req.body.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	if span.TraceID != "0af7651916cd43dd8448eb211c80319c" || span.ParentSpanID != "b7ad6b7169203331" {
+		t.Errorf("Expected the span to join the parent trace, got trace %s parent %s", span.TraceID, span.ParentSpanID)
+	}
+	if span.Name != "make" {
+		t.Errorf("Expected span name make, got %s", span.Name)
+	}
+	if span.Status.Code != statusError || span.Status.Message != ReasonTimeout {
+		t.Errorf("Expected an error status for the timeout, got %+v", span.Status)
+	}
+	if span.Start != formatNanos(start) || span.End != formatNanos(start.Add(10*time.Second)) {
+		t.Errorf("Expected the span to last 10s from %s, got %s to %s", formatNanos(start), span.Start, span.End)
+	}
+	if len(span.Events) != 1 || span.Events[0].Name != "signal" || span.Events[0].Attributes[0].Value["stringValue"] != "TERM" ||
+		span.Events[0].Time != formatNanos(start.Add(10*time.Second)) {
+		t.Errorf("Expected a TERM signal event at the timeout, got %+v", span.Events)
+	}
+
+	expected := "TRACEPARENT=00-0af7651916cd43dd8448eb211c80319c-" + span.SpanID + "-01"
+	if strings.Join(starter.spec.Env, " ") != expected {
+		t.Errorf("Expected the command to get %s, got %v", expected, starter.spec.Env)
+	}
+}
+
+func TestRunTimeoutTraceParallel(t *testing.T) {
+	c := newCollector(t, http.StatusOK)
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", c.server.URL)
+	t.Setenv("TRACEPARENT", "")
+
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", Parallel: true, Stdout: &stdout, Stderr: &stderr}
+
+	result := runTimeout(config, []string{"5s", "true", ":::", "sh", "-c", "exit 3"})
+
+	if result.ExitCode != 3 {
+		t.Errorf("Expected exit code 3, got %d", result.ExitCode)
+	}
+	req := <-c.requests
+	spans := req.body.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 3 {
+		t.Fatalf("Expected a span for the run and each command, got %d", len(spans))
+	}
+	for _, child := range spans[1:] {
+		if child.TraceID != spans[0].TraceID || child.ParentSpanID != spans[0].SpanID {
+			t.Errorf("Expected command spans under the run's span, got %+v", child)
+		}
+	}
+	if spans[1].Status.Code != statusOK || spans[2].Status.Code != statusError || spans[2].Status.Message != "exit status 3" {
+		t.Errorf("Expected statuses OK and exit status 3, got %+v and %+v", spans[1].Status, spans[2].Status)
+	}
+}
+
+func TestRunTimeoutTraceEnv(t *testing.T) {
+	c := newCollector(t, http.StatusOK)
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", c.server.URL)
+	t.Setenv("TRACEPARENT", "")
+
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", Stdout: &stdout, Stderr: &stderr}
+
+	result := runTimeout(config, []string{"5s", "sh", "-c", "echo $TRACEPARENT"})
+
+	if result.ExitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d", result.ExitCode)
+	}
+	span := (<-c.requests).body.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	expected := "00-" + span.TraceID + "-" + span.SpanID + "-01\n"
+	if stdout.String() != expected {
+		t.Errorf("Expected the command to see TRACEPARENT %q, got %q", expected, stdout.String())
+	}
+	if span.ParentSpanID != "" {
+		t.Errorf("Expected a root span without a TRACEPARENT, got parent %s", span.ParentSpanID)
+	}
+}
+
+func TestRunTimeoutTraceExportFailure(t *testing.T) {
+	c := newCollector(t, http.StatusServiceUnavailable)
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", c.server.URL)
+
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", Stdout: &stdout, Stderr: &stderr}
+
+	result := runTimeout(config, []string{"5s", "true"})
+
+	if result.ExitCode != 0 {
+		t.Errorf("A failed export should not change the exit code, got %d", result.ExitCode)
+	}
+	if !strings.Contains(stderr.String(), "timeout: cannot export trace: collector returned 503") {
+		t.Errorf("Expected an export error, got %q", stderr.String())
+	}
+}
+
+func TestRunTimeoutTraceUnsupportedProtocol(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://127.0.0.1:1")
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+
+	var stdout, stderr SafeBuffer
+	config := Config{SignalName: "TERM", Stdout: &stdout, Stderr: &stderr}
+
+	result := runTimeout(config, []string{"5s", "true"})
+
+	if result.ExitCode != 0 {
+		t.Errorf("Expected the command to run anyway, got %d", result.ExitCode)
+	}
+	if !strings.Contains(stderr.String(), "timeout: not exporting trace: unsupported OTLP protocol 'grpc'") {
+		t.Errorf("Expected a warning, got %q", stderr.String())
+	}
+}
+
+// formatNanos formats t as OTLP/JSON does
+func formatNanos(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}